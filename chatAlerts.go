@@ -0,0 +1,122 @@
+package nan0chat
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// shortest time between two runs of the notification command
+const notify_interval = 10 * time.Second
+
+// Builds the pattern finding mentions of the user and the comma separated keywords, ignoring case
+func alertPattern(userName, keywords string) *regexp.Regexp {
+	terms := []string{regexp.QuoteMeta("@" + userName)}
+	for _, keyword := range strings.Split(keywords, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			terms = append(terms, regexp.QuoteMeta(keyword))
+		}
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// Returns the locations of the mentions and keywords found by the pattern in the text, leaving out those that
+// are only part of a longer word
+func alertMatches(pattern *regexp.Regexp, text string) (matches [][]int) {
+	if pattern == nil {
+		return nil
+	}
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		before, _ := utf8.DecodeLastRuneInString(text[:match[0]])
+		after, _ := utf8.DecodeRuneInString(text[match[1]:])
+		if !isWordRune(before) && !isWordRune(after) {
+			matches = append(matches, match)
+		}
+	}
+	return
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Returns true when a message sent by another user mentions the local user or one of the keywords, or is
+// sent to the local user directly
+func (chatUi *ChatClientUI) alerts(message *ChatMessage) bool {
+	if message.UserId == chatUi.userId {
+		return false
+	}
+	if message.Recipient != "" {
+		return true
+	}
+	// the name of the sender in front of the message is no mention
+	text := strings.TrimPrefix(message.Message, "@"+message.UserName+": ")
+	return len(alertMatches(chatUi.highlight, text)) > 0
+}
+
+// Rings the terminal bell for a message that alerts the user and runs the notification command, unless do not
+// disturb is on. The command runs at most once every notify_interval, with the sender and tab of the message and
+// the message itself as its last two arguments.
+func (chatUi *ChatClientUI) notify(tab *chatTab, message *ChatMessage) {
+	if chatUi.doNotDisturb {
+		return
+	}
+	chatUi.screen.WriteRaw("\a")
+	if *NotifyCommand == "" || time.Since(chatUi.lastNotified) < notify_interval {
+		return
+	}
+	chatUi.lastNotified = time.Now()
+
+	args := strings.Fields(*NotifyCommand)
+	args = append(args, fmt.Sprintf("%v in %v", message.UserName, tab.name()), message.Message)
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		chatUi.notice = fmt.Sprintf("Couldn't run the notification command: %v", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// Turns do not disturb on or off, as named by the arguments, or toggles it when there are none
+func (chatUi *ChatClientUI) toggleDoNotDisturb(args string) {
+	switch args {
+	case "on":
+		chatUi.doNotDisturb = true
+	case "off":
+		chatUi.doNotDisturb = false
+	case "":
+		chatUi.doNotDisturb = !chatUi.doNotDisturb
+	default:
+		chatUi.notice = "Usage: /dnd [on|off]"
+		return
+	}
+	if chatUi.doNotDisturb {
+		chatUi.notice = "Do not disturb is on, mentions are still highlighted"
+	} else {
+		chatUi.notice = "Do not disturb is off"
+	}
+}
+
+// Sets the title of the terminal window to the number of messages not read yet, in the tab shown and in every
+// other tab, so that they are noticed while the terminal is in the background
+func (chatUi *ChatClientUI) updateTerminalTitle() {
+	unread := chatUi.outputBox.unread
+	for _, tab := range chatUi.tabs {
+		unread += tab.unread
+	}
+	title := "nan0chat " + chatUi.tab().name()
+	if unread > 0 {
+		title = fmt.Sprintf("(%v) %v", unread, title)
+	}
+	// the name of the tab may come from another user, a control character in it would end the sequence early
+	title = withoutControls(title, false)
+	if title == chatUi.terminalTitle {
+		return
+	}
+	chatUi.terminalTitle = title
+	chatUi.screen.WriteRaw("\x1b]0;" + title + "\a")
+}
@@ -4,8 +4,22 @@ import (
 	"time"
 	"fmt"
 	"github.com/Yomiji/nan0"
+	"github.com/golang/protobuf/proto"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+// the room every client joins when it connects
+const default_room = "general"
+
+// longest time spent telling the server the user is leaving before the connection is closed anyway
+const leave_timeout = 2 * time.Second
+
+// most messages from the ui kept waiting for the connection, the oldest are dropped beyond it
+const max_outgoing_queue = 256
+
 type ChatClient struct {
 	internal *nan0.Service
 	user     *User
@@ -19,8 +33,11 @@ func NewChatClient() (client *ChatClient) {
 	return
 }
 
-// Connects to the target service (defined in the application flags)
-func (client *ChatClient) Connect() {
+// Connects to the target service (defined in the application flags) and runs the ui until the user quits or the
+// process is interrupted or terminated, then tells the server the user left and closes the connection. Failed
+// attempts to connect are shown in the ui, which lets the user try again. Returns a *TerminalError when the ui
+// can't be drawn.
+func (client *ChatClient) Connect() error {
 	// create the initial client connection descriptor targeting the chat server
 	client.internal = &nan0.Service{
 		HostName:    *Host,
@@ -35,12 +52,177 @@ func (client *ChatClient) Connect() {
 	newUserId := random.Int63()
 	// use this auto-generated username unless a custom username has been assigned
 	client.user = &User{
-		UserName: fmt.Sprintf("Connected_User#%v\n", newUserId),
+		UserId:   newUserId,
+		UserName: fmt.Sprintf("Connected_User#%v", newUserId),
 	}
 	if *CustomUsername != "" {
 		client.user.SetUserName(*CustomUsername)
 	}
 
+	// everything stops when the user quits, or when the process is interrupted or terminated
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// create and start a new UI
+	var chatClientUI ChatClientUI
+	chatClientUI.screen = &TermboxScreen{}
+	chatClientUI.userId = client.user.UserId
+	chatClientUI.userName = client.user.UserName
+	chatClientUI.highlight = alertPattern(client.user.UserName, *Keywords)
+	chatClientUI.openTab(default_room, "")
+	chatClientUI.server = fmt.Sprintf("%v:%v", *Host, *Port)
+	chatClientUI.statusSegments = parseStatusSegments(*StatusBar)
+	// lines sent to this server before can be recalled
+	history, err := openInputHistory(chatClientUI.server)
+	if err != nil {
+		chatClientUI.notice = fmt.Sprintf("Input history not loaded: %v", err)
+	}
+	chatClientUI.history = history
+	if *ViMode {
+		chatClientUI.vi = &viState{}
+	}
+	chatClientUI.keyBindings, err = loadKeyBindings(*KeysFile)
+	if err != nil {
+		chatClientUI.notice = fmt.Sprintf("Keys file not loaded: %v", err)
+	}
+	// create a message channel for passing ui message to backend and to server, and one passing messages from
+	// the server and the state of the connection to the ui, which is the only goroutine touching its state
+	messageChannel := make(chan proto.Message)
+	serverChannel := make(chan interface{})
+	// the ui asks for another attempt to connect on this channel after a failed one
+	retry := make(chan struct{}, 1)
+	chatClientUI.retryChannel = retry
+
+	// connect in the background while the ui shows how it goes, the ui never waits for the connection to send
+	outgoing := queueOutgoing(messageChannel)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.run(ctx, outgoing, serverChannel, retry)
+	}()
+
+	err = chatClientUI.Start(ctx, fmt.Sprintf("@%v: ", client.user.UserName), messageChannel, serverChannel)
+	cancel()
+	<-done
+	return err
+}
+
+// Takes every message the ui sends as soon as it is sent, even while connecting, and passes them on in order on
+// the channel returned. The channel is closed once the ui closed messageChannel and the messages waiting were
+// taken.
+func queueOutgoing(messageChannel <-chan proto.Message) <-chan proto.Message {
+	outgoing := make(chan proto.Message)
+	go func() {
+		defer close(outgoing)
+		var queue []proto.Message
+		incoming := messageChannel
+		for incoming != nil || len(queue) > 0 {
+			// the channel onwards is only ready while a message waits for it
+			var out chan<- proto.Message
+			var next proto.Message
+			if len(queue) > 0 {
+				out, next = outgoing, queue[0]
+			}
+			select {
+			case message, ok := <-incoming:
+				if !ok {
+					incoming = nil
+					continue
+				}
+				queue = append(queue, message)
+				if len(queue) > max_outgoing_queue {
+					queue = queue[1:]
+				}
+			case out <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+	return outgoing
+}
+
+// Connects to the server and passes messages between it and the ui until the ui closes messageChannel. Failed
+// attempts to connect are passed to the ui, which asks for another attempt on retry, a lost connection is
+// connected again right away.
+func (client *ChatClient) run(ctx context.Context, messageChannel <-chan proto.Message,
+	serverChannel chan<- interface{}, retry <-chan struct{}) {
+	// the ui may be gone by the time something is passed to it
+	post := func(message interface{}) {
+		select {
+		case serverChannel <- message:
+		case <-ctx.Done():
+		}
+	}
+	for {
+		nan0chat, err := client.dial(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			post(err)
+			// messages sent while there is no connection are dropped
+			for waiting := true; waiting; {
+				select {
+				case _, ok := <-messageChannel:
+					if !ok {
+						return
+					}
+				case <-retry:
+					waiting = false
+				}
+			}
+			post(state_reconnecting)
+			continue
+		}
+
+		post(state_connected)
+		lost := client.relay(nan0chat, messageChannel, serverChannel)
+		// close the connection when this application closes
+		nan0chat.Close()
+		if !lost {
+			return
+		}
+		post(state_reconnecting)
+	}
+}
+
+// Opens a secure connection to the server, giving up once ctx is done. Dialing doesn't take a context, so it goes
+// on in the background then and closes the connection if it still opens.
+func (client *ChatClient) dial(ctx context.Context) (nan0.NanoServiceWrapper, error) {
+	type dialed struct {
+		nan0chat nan0.NanoServiceWrapper
+		err      error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		nan0chat, err := client.dialServer()
+		result <- dialed{nan0chat, err}
+	}()
+	select {
+	case dialed := <-result:
+		return dialed.nan0chat, dialed.err
+	case <-ctx.Done():
+		go func() {
+			if dialed := <-result; dialed.err == nil {
+				dialed.nan0chat.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Opens a secure connection to the server, waiting as long as it takes
+func (client *ChatClient) dialServer() (nan0.NanoServiceWrapper, error) {
 	// convert the base64 keys to usable byte arrays
 	encKey, authKey := KeysToNan0Bytes(*EncryptKey, *Signature)
 
@@ -49,39 +231,87 @@ func (client *ChatClient) Connect() {
 		ReceiveBuffer(1).
 		SendBuffer(0).
 		AddMessageIdentity(new(ChatMessage)).
+		AddMessageIdentity(new(SearchRequest)).
+		AddMessageIdentity(new(SearchResponse)).
+		AddMessageIdentity(new(HistoryRequest)).
+		AddMessageIdentity(new(HistoryResponse)).
+		AddMessageIdentity(new(Presence)).
+		AddMessageIdentity(new(Ping)).
+		AddMessageIdentity(new(User)).
 	Build()
-	// close the connection when this application closes
-	defer nan0chat.Close()
-
 	if err != nil {
-		panic(err)
+		return nil, &ConnectError{Server: fmt.Sprintf("%v:%v", *Host, *Port), Err: err}
 	}
+	return nan0chat, nil
+}
 
+// Passes messages between the connection and the ui. Returns false once the ui closed messageChannel and the
+// server was told the user left, or true when the connection is lost first. Messages from the server wait in a
+// queue until the ui takes them so that the ui can always send.
+func (client *ChatClient) relay(nan0chat nan0.NanoServiceWrapper, messageChannel <-chan proto.Message,
+	serverChannel chan<- interface{}) (lost bool) {
 	// get the channels used to communicate with the server
 	serviceReceiver := nan0chat.GetReceiver()
 	serviceSender := nan0chat.GetSender()
 
-	// create and start a new UI
-	var chatClientUI ChatClientUI
-	// create a message channel for passing ui message to backend and to server
-	messageChannel := make(chan string)
-	go chatClientUI.Start(fmt.Sprintf("@%v: ", client.user.UserName), messageChannel)
-
+	var queue []interface{}
 	for {
+		// the channel to the ui is only ready while a message waits for it
+		var ui chan<- interface{}
+		var next interface{}
+		if len(queue) > 0 {
+			ui, next = serverChannel, queue[0]
+		}
+
 		select {
-		// when a new message comes in, handle it
-		case m := <-serviceReceiver:
-			if message, ok := m.(*ChatMessage); ok {
-				chatClientUI.outputBox.addMessage(message.Message)
+		// when a new message comes in, queue it for the ui
+		case m, ok := <-serviceReceiver:
+			if !ok {
+				return true
+			}
+			if message, ok := m.(proto.Message); ok {
+				queue = append(queue, message)
 			}
-		// when a new message is generated in the UI, broadcast it
-		case newmsg := <-messageChannel:
-			serviceSender <- &ChatMessage{
-				Message:   newmsg,
-				Time:      time.Now().Unix(),
-				MessageId: random.Int63(),
-				UserId:    random.Int63(),
+		case ui <- next:
+			queue = queue[1:]
+		// when a new message is generated in the UI, broadcast it, until the ui closes the channel
+		case newmsg, ok := <-messageChannel:
+			if !ok {
+				client.leave(serviceSender, serviceReceiver)
+				return false
+			}
+			serviceSender <- newmsg
+		}
+	}
+}
+
+// Tells the server the user is going offline and waits until the server has handled every message sent before,
+// or until leave_timeout passes
+func (client *ChatClient) leave(serviceSender chan<- interface{}, serviceReceiver <-chan interface{}) {
+	timeout := time.After(leave_timeout)
+	// the server answers pings in turn with the other messages, so the answer to a ping sent last
+	// comes once everything sent before it was handled
+	// (the ui may still be using the random number generator, which isn't safe for use by several goroutines)
+	now := time.Now().UnixNano()
+	ping := &Ping{RequestId: now, Time: now}
+	for _, message := range []proto.Message{
+		&Presence{UserId: client.user.UserId, UserName: client.user.UserName, State: Presence_OFFLINE},
+		ping,
+	} {
+		select {
+		case serviceSender <- message:
+		case <-timeout:
+			return
+		}
+	}
+	for {
+		select {
+		case message, ok := <-serviceReceiver:
+			if answer, isPing := message.(*Ping); !ok || isPing && answer.RequestId == ping.RequestId {
+				return
 			}
+		case <-timeout:
+			return
 		}
 	}
 }
@@ -0,0 +1,29 @@
+package nan0chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestQueueOutgoingNeverBlocksTheUi(t *testing.T) {
+	messageChannel := make(chan proto.Message)
+	outgoing := queueOutgoing(messageChannel)
+	// nothing reads outgoing yet, as while connecting
+	for i := 0; i < 3; i++ {
+		select {
+		case messageChannel <- &Ping{RequestId: int64(i)}:
+		case <-time.After(time.Second):
+			t.Fatalf("sending message %v blocked", i)
+		}
+	}
+	close(messageChannel)
+	var received []int64
+	for message := range outgoing {
+		received = append(received, message.(*Ping).RequestId)
+	}
+	if len(received) != 3 || received[0] != 0 || received[1] != 1 || received[2] != 2 {
+		t.Errorf("received %v, want [0 1 2]", received)
+	}
+}
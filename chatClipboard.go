@@ -0,0 +1,85 @@
+package nan0chat
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// terminals silently drop OSC 52 sequences longer than this, so longer copies go to the clipboard file
+const osc52_max_length = 100000
+
+// Copies text to the system clipboard of the terminal the client is displayed on using the OSC 52 escape
+// sequence, which also works over SSH. When the terminal doesn't support it the text is written to the
+// clipboard file instead. Returns the clipboard file path when it was used.
+func copyToClipboard(screen Screen, text string) (file string, err error) {
+	sequence := osc52Sequence(text)
+	if osc52Supported() && len(sequence) <= osc52_max_length {
+		return "", screen.WriteRaw(sequence)
+	}
+	if file, err = clipboardFile(); err != nil {
+		return "", err
+	}
+	return file, writePrivateFile(file, text)
+}
+
+// Returns the file copied text is written to, the clipboard file of the config directory unless another was given
+func clipboardFile() (string, error) {
+	if *ClipboardFile != "" {
+		return *ClipboardFile, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clipboard"), nil
+}
+
+// Writes the text to the file so that only the user can read it, creating its directory if needed. A file that
+// someone else created first is made private before the text is written, which fails unless it is the user's own.
+func writePrivateFile(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	err = file.Chmod(0600)
+	if err == nil {
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		_, err = file.WriteString(text)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Returns true unless OSC 52 was disabled or the terminal is known not to support it
+func osc52Supported() bool {
+	if !*Osc52 {
+		return false
+	}
+	switch os.Getenv("TERM") {
+	case "", "dumb", "linux":
+		return false
+	}
+	return true
+}
+
+// Builds the escape sequence setting the clipboard to the given text, wrapped so that tmux and screen pass
+// it through to the outer terminal
+func osc52Sequence(text string) string {
+	sequence := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		return "\x1bPtmux;" + strings.Replace(sequence, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	}
+	if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		return "\x1bP" + sequence + "\x1b\\"
+	}
+	return sequence
+}
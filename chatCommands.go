@@ -0,0 +1,50 @@
+package nan0chat
+
+import (
+	"strings"
+)
+
+// A command typed into the edit box as a line starting with a slash
+type chatCommand struct {
+	name        string
+	description string
+	run         func(chatUi *ChatClientUI, args string)
+}
+
+// The commands understood by the client, lines starting with an unknown command are sent as messages
+var chatCommands = []chatCommand{
+	{"copy", "copy the visible transcript to the clipboard", (*ChatClientUI).copyTranscript},
+	{"search", "search the messages in the scrollback", (*ChatClientUI).startSearch},
+	{"find", "search the history kept by the server", (*ChatClientUI).findInHistory},
+	{"more", "show more results of the last /find", (*ChatClientUI).findMore},
+	{"join", "join a room and show its tab", (*ChatClientUI).joinRoom},
+	{"part", "leave a room, or close a direct conversation, and close its tab", (*ChatClientUI).partRoom},
+	{"msg", "send a direct message to a user", (*ChatClientUI).messageUser},
+	{"who", "list the users in the room shown", (*ChatClientUI).listMembers},
+	{"dnd", "turn do not disturb on or off", (*ChatClientUI).toggleDoNotDisturb},
+	{"keys", "list the keys and the actions bound to them", (*ChatClientUI).listKeys},
+	{"quit", "leave the chat", (*ChatClientUI).quit},
+}
+
+// Ends the ui once the command line is handled
+func (chatUi *ChatClientUI) quit(args string) {
+	chatUi.quitting = true
+}
+
+// Runs the command in the line if it names one, returning false when the line should be sent as a message
+func (chatUi *ChatClientUI) runCommand(line string) bool {
+	if !strings.HasPrefix(line, "/") {
+		return false
+	}
+	name, args := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, args = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	for _, command := range chatCommands {
+		if command.name == name {
+			command.run(chatUi, args)
+			return true
+		}
+	}
+	return false
+}
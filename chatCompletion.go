@@ -0,0 +1,235 @@
+package nan0chat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// most candidates listed at once in the completion popup
+const max_completion_popup = 8
+
+// The emoji shortcodes completed after a colon, such as :smile:
+var emojiShortcodes = []struct{ code, emoji string }{
+	{"+1", "👍"},
+	{"-1", "👎"},
+	{"100", "💯"},
+	{"beer", "🍺"},
+	{"bug", "🐛"},
+	{"check", "✅"},
+	{"clap", "👏"},
+	{"coffee", "☕"},
+	{"cry", "😢"},
+	{"eyes", "👀"},
+	{"facepalm", "🤦"},
+	{"fire", "🔥"},
+	{"grin", "😁"},
+	{"heart", "❤"},
+	{"joy", "😂"},
+	{"laughing", "😆"},
+	{"muscle", "💪"},
+	{"ok_hand", "👌"},
+	{"party", "🎉"},
+	{"pray", "🙏"},
+	{"raised_hands", "🙌"},
+	{"rocket", "🚀"},
+	{"sad", "😞"},
+	{"shrug", "🤷"},
+	{"skull", "💀"},
+	{"slightly_smiling_face", "🙂"},
+	{"smile", "😄"},
+	{"smiley", "😃"},
+	{"sob", "😭"},
+	{"sparkles", "✨"},
+	{"star", "⭐"},
+	{"sunglasses", "😎"},
+	{"tada", "🎉"},
+	{"thinking", "🤔"},
+	{"thumbsdown", "👎"},
+	{"thumbsup", "👍"},
+	{"upside_down", "🙃"},
+	{"warning", "⚠"},
+	{"wave", "👋"},
+	{"wink", "😉"},
+	{"x", "❌"},
+	{"zzz", "💤"},
+}
+
+// The completions of the word before the cursor offered by Tab
+type completion struct {
+	// byte offset in the edit box of the start of the word being completed
+	start      int
+	candidates []completionCandidate
+	// index of the candidate in the edit box, -1 while only the part every candidate shares is
+	index int
+}
+
+// A word the word before the cursor can be completed to
+type completionCandidate struct {
+	// shown in the popup
+	label string
+	// replaces the word
+	text string
+}
+
+// Completes the word before the cursor: a command at the start of the message, a user after @ or after /msg,
+// a room after # or after /join and /part, or an emoji shortcode after a colon. A word with several completions
+// is extended as far as they agree and the completions are listed, pressing Tab again cycles through them.
+func (chatUi *ChatClientUI) complete() {
+	eb := &chatUi.editBox
+	if c := chatUi.completion; c != nil && chatUi.previousAction == "complete" {
+		c.index = (c.index + 1) % len(c.candidates)
+		chatUi.replaceCompletion(c.start, c.candidates[c.index].text)
+		return
+	}
+	chatUi.completion = nil
+	start := eb.lineStart()
+	if i := strings.LastIndexAny(string(eb.text[start:eb.cursor_boffset]), " \t"); i >= 0 {
+		start += i + 1
+	}
+	word := string(eb.text[start:eb.cursor_boffset])
+	candidates := chatUi.completionCandidates(string(eb.text[:start]), word)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		chatUi.replaceCompletion(start, candidates[0].text)
+		return
+	}
+	chatUi.completion = &completion{start: start, candidates: candidates, index: -1}
+	if prefix := sharedPrefix(candidates); len(prefix) > len(word) {
+		chatUi.replaceCompletion(start, prefix)
+	}
+}
+
+// Returns the completions of the word, given the text of the message before it
+func (chatUi *ChatClientUI) completionCandidates(before, word string) (candidates []completionCandidate) {
+	add := func(label, text string) {
+		if len(label) > len(word) && strings.HasPrefix(strings.ToLower(label), strings.ToLower(word)) {
+			candidates = append(candidates, completionCandidate{label, text})
+		}
+	}
+	command := strings.TrimSpace(before)
+	switch {
+	case before == "" && strings.HasPrefix(word, "/"):
+		for _, c := range chatCommands {
+			add("/"+c.name, "/"+c.name+" ")
+		}
+	case strings.HasPrefix(word, "@"):
+		for _, user := range chatUi.knownUsers() {
+			add("@"+user, "@"+user+" ")
+		}
+	case strings.HasPrefix(word, "#"):
+		for _, room := range chatUi.knownRooms() {
+			add("#"+room, "#"+room+" ")
+		}
+	case strings.HasPrefix(word, ":") && len(word) > 1:
+		for _, e := range emojiShortcodes {
+			if strings.HasPrefix(":"+e.code+":", word) {
+				candidates = append(candidates, completionCandidate{e.emoji + " :" + e.code + ":", e.emoji})
+			}
+		}
+		return
+	case command == "/msg" && strings.Count(before, " ") == 1:
+		for _, user := range chatUi.knownUsers() {
+			add(user, user+" ")
+		}
+	case (command == "/join" || command == "/part") && strings.Count(before, " ") == 1:
+		for _, room := range chatUi.knownRooms() {
+			add(room, room)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return strings.ToLower(candidates[i].label) < strings.ToLower(candidates[j].label)
+	})
+	return
+}
+
+// Returns the other users known to be online, in a room joined or in a direct conversation
+func (chatUi *ChatClientUI) knownUsers() []string {
+	users := append([]string{}, chatUi.online...)
+	for _, tab := range chatUi.tabs {
+		users = append(users, tab.members...)
+		if tab.peer != "" {
+			users = append(users, tab.peer)
+		}
+	}
+	return uniqueStrings(removeString(users, chatUi.userName))
+}
+
+// Returns the rooms of the open tabs and the room every client joins
+func (chatUi *ChatClientUI) knownRooms() []string {
+	rooms := []string{default_room}
+	for _, tab := range chatUi.tabs {
+		if tab.room != "" {
+			rooms = append(rooms, tab.room)
+		}
+	}
+	return uniqueStrings(rooms)
+}
+
+// Returns the strings sorted, each once
+func uniqueStrings(list []string) (result []string) {
+	sort.Strings(list)
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			result = append(result, s)
+		}
+	}
+	return
+}
+
+// Returns the text every candidate starts with
+func sharedPrefix(candidates []completionCandidate) string {
+	prefix := strings.TrimSuffix(candidates[0].text, " ")
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c.text, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return strings.ToValidUTF8(prefix, "")
+}
+
+// Replaces the text from the byte offset to the cursor with the completion
+func (chatUi *ChatClientUI) replaceCompletion(start int, text string) {
+	eb := &chatUi.editBox
+	eb.SaveUndo(edit_other)
+	eb.text = byte_slice_remove(eb.text, start, eb.cursor_boffset)
+	eb.MoveCursorTo(start)
+	for _, r := range text {
+		eb.insertRune(r)
+	}
+}
+
+// Draws the completions listed above the edit box, the bottom row of the list at the given row and its left
+// edge at the column of the word completed. The list scrolls to keep the candidate in the edit box in view.
+func (chatUi *ChatClientUI) drawCompletion(x, bottom int) {
+	const coldef = termbox.ColorDefault
+	screen := chatUi.screen
+	c := chatUi.completion
+	first := maxInt(c.index-max_completion_popup+1, 0)
+	shown := c.candidates[first:minInt(first+max_completion_popup, len(c.candidates))]
+	labels := make([]string, len(shown))
+	width := 0
+	for i, candidate := range shown {
+		labels[i] = candidate.label
+		width = maxInt(width, runewidth.StringWidth(candidate.label))
+	}
+	if hidden := len(c.candidates) - len(shown); hidden > 0 {
+		labels = append(labels, fmt.Sprintf("(%v more)", hidden))
+		width = maxInt(width, runewidth.StringWidth(labels[len(labels)-1]))
+	}
+	x = maxInt(minInt(x, chatUi.termWidth-width-2), 0)
+	y := bottom - len(labels) + 1
+	for i, label := range labels {
+		fg := coldef
+		if first+i == c.index && i < len(shown) {
+			fg |= termbox.AttrReverse
+		}
+		fill(screen, x, y+i, width+2, 1, termbox.Cell{Ch: ' ', Fg: fg, Bg: coldef})
+		tbprint(screen, x+1, y+i, fg, coldef, label)
+	}
+}
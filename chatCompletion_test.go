@@ -0,0 +1,75 @@
+package nan0chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletionCandidates(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.userName = "me"
+	chatUi.online = []string{"bob", "Alice", "me", "albert"}
+	chatUi.openTab("", "carol")
+	chatUi.openTab("games", "").members = []string{"bob", "dave"}
+	tests := []struct {
+		before, word string
+		want         []string
+	}{
+		{"", "/m", []string{"/more ", "/msg "}},
+		{"", "/MS", []string{"/msg "}},
+		{"hi ", "/m", nil},
+		{"", "/msg", nil},
+		{"hi ", "@a", []string{"@albert ", "@Alice "}},
+		{"hi ", "@", []string{"@albert ", "@Alice ", "@bob ", "@carol ", "@dave "}},
+		{"hi ", "@m", nil},
+		{"", "#g", []string{"#games ", "#" + default_room + " "}},
+		{"/msg ", "c", []string{"carol "}},
+		{"/msg bob ", "c", nil},
+		{"/join ", "ga", []string{"games"}},
+		{"/part ", "", []string{"games", default_room}},
+		{"nice ", ":thu", []string{"👎", "👍"}},
+		{"nice ", ":thumbsup:", []string{"👍"}},
+		{"nice ", ":", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, c := range chatUi.completionCandidates(test.before, test.word) {
+			got = append(got, c.text)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q %q: got %q, want %q", test.before, test.word, got, test.want)
+		}
+	}
+}
+
+func TestSharedPrefix(t *testing.T) {
+	tests := []struct {
+		texts []string
+		want  string
+	}{
+		{[]string{"/more ", "/msg "}, "/m"},
+		{[]string{"@albert ", "@alice "}, "@al"},
+		{[]string{"games", "gamers"}, "game"},
+		{[]string{"@Alice ", "@alice "}, "@"},
+		{[]string{"👍", "👎"}, ""},
+	}
+	for _, test := range tests {
+		var candidates []completionCandidate
+		for _, text := range test.texts {
+			candidates = append(candidates, completionCandidate{text, text})
+		}
+		if got := sharedPrefix(candidates); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.texts, got, test.want)
+		}
+	}
+}
+
+func TestUniqueStrings(t *testing.T) {
+	got := uniqueStrings([]string{"b", "a", "b", "c", "a"})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := uniqueStrings(nil); got != nil {
+		t.Errorf("got %q for no strings", got)
+	}
+}
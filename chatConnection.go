@@ -0,0 +1,78 @@
+package nan0chat
+
+import (
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// Shows the new state of the connection to the server. Once connected the user is announced, the rooms of the
+// open tabs are joined again and requests a lost connection left unanswered are forgotten.
+func (chatUi *ChatClientUI) setConnection(state connectionState) {
+	chatUi.connection = state
+	if state != state_connected {
+		return
+	}
+	chatUi.failure = nil
+	chatUi.ping = nil
+	chatUi.messageChannel <- &Presence{
+		UserId:   chatUi.userId,
+		UserName: chatUi.userName,
+		State:    Presence_ONLINE,
+	}
+	for _, tab := range chatUi.tabs {
+		tab.box.historyRequest = nil
+		if tab.room != "" {
+			chatUi.sendPresence(Presence_JOIN, tab.room)
+		}
+	}
+	// start with the latest history of the room shown, and measure the round trip right away
+	if len(chatUi.outputBox.messages) == 0 {
+		chatUi.loadOlderHistory()
+	}
+	chatUi.sendPing()
+}
+
+// Shows the failed attempt to connect over the output box until the user tries again or quits
+func (chatUi *ChatClientUI) connectionFailed(err error) {
+	chatUi.connection = state_offline
+	chatUi.failure = err
+	chatUi.details = nil
+}
+
+// Handles a key press while a failed attempt to connect is shown, returning true when the user quits
+func (chatUi *ChatClientUI) handleFailureKey(ev termbox.Event) bool {
+	switch action := chatUi.boundAction(ev); {
+	case action == "escape" || action == "quit":
+		return true
+	case ev.Ch == 'r':
+		chatUi.failure = nil
+		chatUi.connection = state_reconnecting
+		// the backend is waiting for the request, it is never asked twice
+		select {
+		case chatUi.retryChannel <- struct{}{}:
+		default:
+		}
+	}
+	return false
+}
+
+// Draws the failed attempt to connect in a box at the given location
+func (chatUi *ChatClientUI) drawFailure(x, y, w int) {
+	const coldef = termbox.ColorDefault
+	screen := chatUi.screen
+	lines := []string{"Not connected", ""}
+	lines = append(lines, wrapText(chatUi.failure.Error(), w)...)
+	lines = append(lines, "", "Press r to try again"+
+		chatUi.keyHintsInParentheses(keyHint{"escape", "to quit"}))
+
+	fill(screen, x-1, y-1, w+2, len(lines)+2, termbox.Cell{Ch: ' '})
+	fill(screen, x-1, y-1, w+2, 1, termbox.Cell{Ch: '─'})
+	fill(screen, x-1, y+len(lines), w+2, 1, termbox.Cell{Ch: '─'})
+	for i, line := range lines {
+		fg := coldef
+		if i == 0 {
+			fg = termbox.ColorRed | termbox.AttrBold
+		}
+		tbprint(screen, x, y+i, fg, coldef, runewidth.Truncate(line, w, "…"))
+	}
+}
@@ -0,0 +1,230 @@
+package nan0chat
+
+import (
+	"unicode/utf8"
+)
+
+// most changes of the edit box that can be undone
+const max_undo = 100
+
+// most pieces of killed text kept for yanking
+const max_kill_ring = 30
+
+// The kind of a change to the edit box, runs of typing are undone at once
+type editKind int
+
+const (
+	edit_other editKind = iota
+	edit_typing
+)
+
+// The contents of the edit box and the position of its cursor in bytes
+type editSnapshot struct {
+	text   string
+	cursor int
+}
+
+// Returns the contents of the edit box and its cursor
+func (eb *EditBox) snapshot() editSnapshot {
+	return editSnapshot{string(eb.text), eb.cursor_boffset}
+}
+
+// Brings the edit box back to the snapshot
+func (eb *EditBox) restore(snapshot editSnapshot) {
+	eb.text = []byte(snapshot.text)
+	eb.MoveCursorTo(snapshot.cursor)
+}
+
+// Saves the edit box before a change so it can be undone. Typing continuing where the previous typing left the
+// cursor joins the change saved for it instead.
+func (eb *EditBox) SaveUndo(kind editKind) {
+	joined := kind == edit_typing && eb.last_edit == edit_typing && eb.cursor_boffset == eb.typed_at
+	eb.last_edit = kind
+	if joined {
+		return
+	}
+	eb.undo = append(eb.undo, eb.snapshot())
+	if len(eb.undo) > max_undo {
+		eb.undo = eb.undo[1:]
+	}
+	eb.redo = nil
+}
+
+// Makes the next typing a change of its own
+func (eb *EditBox) EndUndoGroup() {
+	eb.last_edit = edit_other
+}
+
+// Undoes the latest change, returning false when there is nothing to undo
+func (eb *EditBox) Undo() bool {
+	if len(eb.undo) == 0 {
+		return false
+	}
+	eb.redo = append(eb.redo, eb.snapshot())
+	eb.restore(eb.undo[len(eb.undo)-1])
+	eb.undo = eb.undo[:len(eb.undo)-1]
+	eb.last_edit = edit_other
+	return true
+}
+
+// Makes the latest change undone again, returning false when nothing was undone
+func (eb *EditBox) Redo() bool {
+	if len(eb.redo) == 0 {
+		return false
+	}
+	eb.undo = append(eb.undo, eb.snapshot())
+	eb.restore(eb.redo[len(eb.redo)-1])
+	eb.redo = eb.redo[:len(eb.redo)-1]
+	eb.last_edit = edit_other
+	return true
+}
+
+// Deletes the text between the byte offsets, placing the cursor where it was. Returns the text deleted.
+func (eb *EditBox) deleteRange(from, to int) string {
+	if from == to {
+		return ""
+	}
+	eb.SaveUndo(edit_other)
+	deleted := string(eb.text[from:to])
+	eb.text = byte_slice_remove(eb.text, from, to)
+	eb.MoveCursorTo(from)
+	return deleted
+}
+
+// Returns the offset of the start of the word before the cursor, skipping what isn't a word on the way
+func (eb *EditBox) wordStartBefore() int {
+	pos := eb.cursor_boffset
+	for pos > 0 {
+		r, size := utf8.DecodeLastRune(eb.text[:pos])
+		if isWordRune(r) {
+			break
+		}
+		pos -= size
+	}
+	for pos > 0 {
+		r, size := utf8.DecodeLastRune(eb.text[:pos])
+		if !isWordRune(r) {
+			break
+		}
+		pos -= size
+	}
+	return pos
+}
+
+// Returns the offset of the end of the word after the cursor, skipping what isn't a word on the way
+func (eb *EditBox) wordEndAfter() int {
+	pos := eb.cursor_boffset
+	for pos < len(eb.text) {
+		r, size := utf8.DecodeRune(eb.text[pos:])
+		if isWordRune(r) {
+			break
+		}
+		pos += size
+	}
+	for pos < len(eb.text) {
+		r, size := utf8.DecodeRune(eb.text[pos:])
+		if !isWordRune(r) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+func (eb *EditBox) MoveCursorWordBackward() {
+	eb.MoveCursorTo(eb.wordStartBefore())
+}
+
+func (eb *EditBox) MoveCursorWordForward() {
+	eb.MoveCursorTo(eb.wordEndAfter())
+}
+
+// Deletes back to the start of the word before the cursor, returning the text deleted
+func (eb *EditBox) DeleteWordBackward() string {
+	return eb.deleteRange(eb.wordStartBefore(), eb.cursor_boffset)
+}
+
+// Deletes to the end of the word after the cursor, returning the text deleted
+func (eb *EditBox) DeleteWordForward() string {
+	return eb.deleteRange(eb.cursor_boffset, eb.wordEndAfter())
+}
+
+// Deletes from the start of the line to the cursor, returning the text deleted
+func (eb *EditBox) DeleteToBeginningOfTheLine() string {
+	return eb.deleteRange(eb.lineStart(), eb.cursor_boffset)
+}
+
+// Swaps the rune before the cursor with the rune under it and moves past both, at the end of a line the two
+// runes before the cursor are swapped
+func (eb *EditBox) TransposeRunes() {
+	start, end := eb.lineStart(), eb.lineEnd()
+	pos := eb.cursor_boffset
+	if pos == end && pos > start {
+		_, size := utf8.DecodeLastRune(eb.text[start:pos])
+		pos -= size
+	}
+	if pos == start || pos == end {
+		return
+	}
+	_, before := utf8.DecodeLastRune(eb.text[start:pos])
+	_, under := utf8.DecodeRune(eb.text[pos:end])
+	eb.SaveUndo(edit_other)
+	swapped := string(eb.text[pos:pos+under]) + string(eb.text[pos-before:pos])
+	copy(eb.text[pos-before:], swapped)
+	eb.MoveCursorTo(pos + under)
+}
+
+// Keeps text deleted by a kill action for yanking. Kills right after one another build up a single piece of
+// text, in the order it was in the edit box.
+func (chatUi *ChatClientUI) kill(text string, backward bool) {
+	if text == "" {
+		return
+	}
+	if isKillAction(chatUi.previousAction) && len(chatUi.killRing) > 0 {
+		last := &chatUi.killRing[len(chatUi.killRing)-1]
+		if backward {
+			*last = text + *last
+		} else {
+			*last += text
+		}
+		return
+	}
+	chatUi.killRing = append(chatUi.killRing, text)
+	if len(chatUi.killRing) > max_kill_ring {
+		chatUi.killRing = chatUi.killRing[1:]
+	}
+}
+
+// Returns true for the actions that keep the text they delete for yanking
+func isKillAction(name string) bool {
+	switch name {
+	case "kill-line", "kill-line-backward", "kill-word", "kill-word-backward":
+		return true
+	}
+	return false
+}
+
+// Inserts the text killed last at the cursor
+func (chatUi *ChatClientUI) yank() {
+	if len(chatUi.killRing) == 0 {
+		return
+	}
+	chatUi.yankIndex = len(chatUi.killRing) - 1
+	chatUi.yankStart = chatUi.editBox.cursor_boffset
+	chatUi.editBox.InsertString(chatUi.killRing[chatUi.yankIndex])
+}
+
+// Replaces the text just yanked with the text killed before it, going round the kill ring
+func (chatUi *ChatClientUI) yankPop() {
+	if chatUi.previousAction != "yank" && chatUi.previousAction != "yank-pop" || len(chatUi.killRing) == 0 {
+		return
+	}
+	eb := &chatUi.editBox
+	eb.SaveUndo(edit_other)
+	eb.text = byte_slice_remove(eb.text, chatUi.yankStart, eb.cursor_boffset)
+	eb.MoveCursorTo(chatUi.yankStart)
+	chatUi.yankIndex = (chatUi.yankIndex + len(chatUi.killRing) - 1) % len(chatUi.killRing)
+	for _, r := range chatUi.killRing[chatUi.yankIndex] {
+		eb.insertRune(r)
+	}
+}
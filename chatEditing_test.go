@@ -0,0 +1,111 @@
+package nan0chat
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Presses each key in turn, what isn't the name of a key is typed instead
+func typeKeys(chatUi *ChatClientUI, keys ...string) {
+	for _, key := range keys {
+		press, err := parseKeyPress(key)
+		if err != nil {
+			for _, r := range key {
+				pressKey(chatUi, termbox.Event{Ch: r})
+			}
+			continue
+		}
+		ev := termbox.Event{Key: press.key, Ch: press.ch}
+		if press.alt {
+			ev.Mod = termbox.ModAlt
+		}
+		pressKey(chatUi, ev)
+	}
+}
+
+func TestKillsInARowAreYankedAsOne(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	typeKeys(chatUi, "one two three", "Ctrl-W", "Ctrl-W")
+	if got := string(chatUi.editBox.text); got != "one " {
+		t.Fatalf("got %q after the kills", got)
+	}
+	typeKeys(chatUi, "Ctrl-Y")
+	if got := string(chatUi.editBox.text); got != "one two three" {
+		t.Errorf("got %q after the yank", got)
+	}
+}
+
+func TestYankPopGoesRoundTheKillRing(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	typeKeys(chatUi, "Alt-y")
+	if got := string(chatUi.editBox.text); got != "" {
+		t.Fatalf("yank-pop without a yank inserted %q", got)
+	}
+	typeKeys(chatUi, "one", "Ctrl-U", "two", "Ctrl-U", "<", "Ctrl-Y")
+	steps := []struct{ key, want string }{
+		{"", "<two"},
+		{"Alt-y", "<one"},
+		{"Alt-y", "<two"},
+	}
+	for _, step := range steps {
+		if step.key != "" {
+			typeKeys(chatUi, step.key)
+		}
+		if got := string(chatUi.editBox.text); got != step.want {
+			t.Errorf("after %q got %q, want %q", step.key, got, step.want)
+		}
+	}
+}
+
+func TestUndoAndRedo(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	typeKeys(chatUi, "one two", "Ctrl-W")
+	steps := []struct{ key, want string }{
+		{"Ctrl-_", "one two"},
+		{"Ctrl-_", ""},
+		{"Ctrl-_", ""},
+		{"Alt-_", "one two"},
+		{"Alt-_", "one "},
+		{"Alt-_", "one "},
+		{"Ctrl-_", "one two"},
+	}
+	for i, step := range steps {
+		typeKeys(chatUi, step.key)
+		if got := string(chatUi.editBox.text); got != step.want {
+			t.Errorf("step %v, %v: got %q, want %q", i, step.key, got, step.want)
+		}
+	}
+	// a change after undoing leaves nothing to redo
+	typeKeys(chatUi, "!", "Alt-_")
+	if got := string(chatUi.editBox.text); got != "one two!" {
+		t.Errorf("redo after a change: got %q", got)
+	}
+}
+
+func TestTransposeRunes(t *testing.T) {
+	tests := []struct {
+		text       string
+		cursor     int
+		want       string
+		wantCursor int
+	}{
+		{"abc", 1, "bac", 2},
+		{"abc", 3, "acb", 3},
+		{"abc", 0, "abc", 0},
+		{"a", 1, "a", 1},
+		{"ab\ncd", 2, "ba\ncd", 2},
+		{"ab\ncd", 3, "ab\ncd", 3},
+		{"éa", 2, "aé", 3},
+	}
+	for _, test := range tests {
+		var eb EditBox
+		eb.SetText(test.text)
+		eb.MoveCursorTo(test.cursor)
+		eb.TransposeRunes()
+		if got := string(eb.text); got != test.want || eb.cursor_boffset != test.wantCursor {
+			t.Errorf("%q at %v: got %q at %v, want %q at %v", test.text, test.cursor, got, eb.cursor_boffset,
+				test.want, test.wantCursor)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package nan0chat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Writes the message in an external editor, the one named by $VISUAL or $EDITOR or else vi. The terminal is
+// handed over to the editor until it exits, then the text it saved replaces the message to be sent as usual.
+func (chatUi *ChatClientUI) editInEditor() {
+	file, err := ioutil.TempFile("", "nan0chat-*.txt")
+	if err != nil {
+		chatUi.notice = fmt.Sprintf("Editor not started: %v", err)
+		return
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(string(chatUi.editBox.text))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		chatUi.notice = fmt.Sprintf("Editor not started: %v", err)
+		return
+	}
+	err = chatUi.screen.Suspend(func() error { return runEditor(file.Name()) })
+	// the terminal may have been resized and retitled meanwhile
+	chatUi.terminalTitle = ""
+	chatUi.resize(chatUi.screen.Size())
+	if err != nil {
+		chatUi.notice = fmt.Sprintf("Editor failed, the message is unchanged: %v", err)
+		return
+	}
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		chatUi.notice = fmt.Sprintf("Edited message not read: %v", err)
+		return
+	}
+	// editors end the last line with a line break that isn't part of the message
+	chatUi.editBox.SetText(strings.TrimRight(string(data), "\r\n"))
+	if chatUi.vi != nil {
+		chatUi.viClamp()
+	}
+}
+
+// Runs the user's editor on the file in the terminal, returning once it exits
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// the variable may hold arguments too, as in "code --wait"
+	args := append(strings.Fields(editor), path)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
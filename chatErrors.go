@@ -0,0 +1,47 @@
+package nan0chat
+
+import (
+	"fmt"
+)
+
+// The error returned when the client can't connect to the chat server
+type ConnectError struct {
+	// the server as host:port
+	Server string
+	Err    error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("couldn't connect to %v: %v", e.Server, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// The error returned when the chat server can't start listening for clients
+type ServeError struct {
+	Port int
+	Err  error
+}
+
+func (e *ServeError) Error() string {
+	return fmt.Sprintf("couldn't serve on port %v: %v", e.Port, e.Err)
+}
+
+func (e *ServeError) Unwrap() error {
+	return e.Err
+}
+
+// The error returned when the terminal the client is drawn on can't be used
+type TerminalError struct {
+	Err error
+}
+
+func (e *TerminalError) Error() string {
+	return fmt.Sprintf("terminal error: %v", e.Err)
+}
+
+func (e *TerminalError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,129 @@
+package nan0chat
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// longest time between an escape and the key it is joined with into an Alt key combination
+const alt_key_delay = 20 * time.Millisecond
+
+// Events added to those of termbox, marking the start and the end of text pasted into the terminal. The keys in
+// between are the text pasted. A paste that stalled ended without the sequence marking its end.
+const (
+	eventPasteStart termbox.EventType = 100 + iota
+	eventPasteEnd
+	eventPasteStalled
+)
+
+// longest pause inside pasted text, a paste that stops for longer without ending most likely lost its end. Slow
+// connections pause pastes too, so it is much longer than they usually do.
+const paste_idle_timeout = 5 * time.Second
+
+// what terminals in bracketed paste mode send before and after the text pasted, once the escape starting them is
+// joined with the [ into Alt-[
+const (
+	paste_start_keys = "200~"
+	paste_end_keys   = "201~"
+)
+
+// Starts reading the events of the screen on their own goroutines and returns the channel they are delivered on,
+// with Alt key combinations joined into single keys and pasted text marked. The screen must be initialized already.
+func readEvents(screen Screen) <-chan termbox.Event {
+	polled := make(chan termbox.Event)
+	joined := make(chan termbox.Event)
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			polled <- screen.PollEvent()
+		}
+	}()
+	go joinAltKeys(polled, joined)
+	go markPastes(joined, events)
+	return events
+}
+
+// Passes the polled events on, joining an escape and the key that follows it at once into a single key with
+// the Alt modifier, which is how terminals send Alt key combinations. A lone escape is only told apart from
+// an Alt key by the time that passes before the next key.
+func joinAltKeys(polled <-chan termbox.Event, events chan<- termbox.Event) {
+	var pending *termbox.Event
+	for {
+		var ev termbox.Event
+		if pending != nil {
+			ev, pending = *pending, nil
+		} else {
+			ev = <-polled
+		}
+		if ev.Type == termbox.EventKey && ev.Key == termbox.KeyEsc && ev.Mod == 0 {
+			select {
+			case following := <-polled:
+				if following.Type == termbox.EventKey && following.Key != termbox.KeyEsc {
+					following.Mod |= termbox.ModAlt
+					ev = following
+				} else {
+					pending = &following
+				}
+			case <-time.After(alt_key_delay):
+			}
+		}
+		events <- ev
+	}
+}
+
+// Passes the keys on, replacing the sequences terminals send around pasted text with paste events. The keys of a
+// sequence arrive at once, those that turn out not to be one are passed on as they were. A paste whose end
+// doesn't arrive within paste_idle_timeout of its last key is marked as stalled.
+func markPastes(keys <-chan termbox.Event, events chan<- termbox.Event) {
+	// fires when a paste has been idle for too long, nil outside of pastes
+	var idle <-chan time.Time
+	for {
+		var ev termbox.Event
+		select {
+		case ev = <-keys:
+		case <-idle:
+			idle = nil
+			events <- termbox.Event{Type: eventPasteStalled}
+			continue
+		}
+		if idle != nil {
+			idle = time.After(paste_idle_timeout)
+		}
+		if ev.Type != termbox.EventKey || ev.Ch != '[' || ev.Mod&termbox.ModAlt == 0 {
+			events <- ev
+			continue
+		}
+		held := []termbox.Event{ev}
+		sequence := ""
+	reading:
+		for len(sequence) < len(paste_start_keys) {
+			select {
+			case next := <-keys:
+				held = append(held, next)
+				if next.Type != termbox.EventKey || next.Mod != 0 || next.Ch == 0 {
+					break reading
+				}
+				sequence += string(next.Ch)
+				if !strings.HasPrefix(paste_start_keys, sequence) && !strings.HasPrefix(paste_end_keys, sequence) {
+					break reading
+				}
+			case <-time.After(alt_key_delay):
+				break reading
+			}
+		}
+		switch sequence {
+		case paste_start_keys:
+			idle = time.After(paste_idle_timeout)
+			events <- termbox.Event{Type: eventPasteStart}
+		case paste_end_keys:
+			idle = nil
+			events <- termbox.Event{Type: eventPasteEnd}
+		default:
+			for _, ev := range held {
+				events <- ev
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package nan0chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// layout of the dates accepted by the after: and before: filters of /find
+const find_date_layout = "2006-01-02"
+
+// Searches the history kept by the server. Besides the words to find, the arguments may hold the filters
+// from:<user name>, in:<room>, after:<date> and before:<date>, dates are given as YYYY-MM-DD.
+func (chatUi *ChatClientUI) findInHistory(args string) {
+	request := &SearchRequest{RequestId: random.Int63()}
+	var words []string
+	for _, field := range strings.Fields(args) {
+		var err error
+		switch {
+		case strings.HasPrefix(field, "from:"):
+			request.UserName = strings.TrimPrefix(strings.TrimPrefix(field, "from:"), "@")
+		case strings.HasPrefix(field, "in:"):
+			request.Room = strings.TrimPrefix(field, "in:")
+		case strings.HasPrefix(field, "after:"):
+			request.FromTime, err = parseFindDate(strings.TrimPrefix(field, "after:"), 0)
+		case strings.HasPrefix(field, "before:"):
+			// the whole day given is included
+			request.ToTime, err = parseFindDate(strings.TrimPrefix(field, "before:"), 24*time.Hour-time.Second)
+		default:
+			words = append(words, field)
+		}
+		if err != nil {
+			chatUi.notice = fmt.Sprintf("Dates are written as YYYY-MM-DD, not %v", field)
+			return
+		}
+	}
+	request.Query = strings.Join(words, " ")
+	if request.Query == "" && request.UserName == "" && request.Room == "" {
+		chatUi.notice = "Usage: /find words [from:user] [in:room] [after:YYYY-MM-DD] [before:YYYY-MM-DD]"
+		return
+	}
+
+	chatUi.resultsRequest = request
+	chatUi.resultsTotal = 0
+	chatUi.notice = "Searching the history…"
+	chatUi.messageChannel <- request
+}
+
+// Requests the next page of results of the last history search
+func (chatUi *ChatClientUI) findMore(args string) {
+	request := chatUi.resultsRequest
+	if request == nil || chatUi.searchResults == nil {
+		chatUi.notice = "Use /find to search the history first"
+		return
+	}
+	offset := int32(len(chatUi.searchResults.messages))
+	if int(offset) >= chatUi.resultsTotal {
+		chatUi.notice = "There are no more results"
+		return
+	}
+	next := *request
+	next.Offset = offset
+	chatUi.messageChannel <- &next
+}
+
+// Returns the unix time of the start of the given local date plus the offset
+func parseFindDate(date string, offset time.Duration) (int64, error) {
+	t, err := time.ParseInLocation(find_date_layout, date, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.Add(offset).Unix(), nil
+}
+
+// Shows a page of history search results in the results pane, the first page opens the pane
+func (chatUi *ChatClientUI) showSearchResults(response *SearchResponse) {
+	request := chatUi.resultsRequest
+	if request == nil || response.RequestId != request.RequestId {
+		return
+	}
+	chatUi.notice = ""
+	chatUi.resultsTotal = int(response.Total)
+	if response.Offset == 0 || chatUi.searchResults == nil {
+		chatUi.thread = nil
+		chatUi.searchResults = chatUi.newPane("")
+		chatUi.searchHits = make(map[*chatEntry]*SearchHit)
+		chatUi.results = chatUi.searchResults
+		chatUi.relayout()
+	}
+
+	results := chatUi.searchResults
+	for _, hit := range response.Hits {
+		entry := &chatEntry{ChatMessage: hit.Message, label: resultLabel(hit.Message)}
+		chatUi.searchHits[entry] = hit
+		results.addMessage(entry)
+	}
+	if response.Offset == 0 {
+		results.scrollToTop()
+	}
+
+	hints := chatUi.keyHints(keyHint{"select", "and " + chatUi.keysOf("submit") + " to jump"},
+		keyHint{"escape", "to close"})
+	if len(results.messages) < chatUi.resultsTotal {
+		hints = append([]string{"/more for more"}, hints...)
+	}
+	results.title = fmt.Sprintf(" %v of %v results for %q (%v) ",
+		len(results.messages), chatUi.resultsTotal, request.Query, strings.Join(hints, ", "))
+}
+
+// Returns the label shown before a search result or a message in its context
+func resultLabel(message *ChatMessage) string {
+	label := time.Unix(message.Time, 0).Format("2006-01-02 15:04") + " "
+	if message.Room != "" {
+		label += "#" + message.Room + " "
+	}
+	return label
+}
+
+// Jumps from a search result to the message it found: the message is selected in the output box of its room
+// when it is held there, otherwise the result is shown along with the messages around it
+func (chatUi *ChatClientUI) jumpToEntry(entry *chatEntry) {
+	hit := chatUi.searchHits[entry]
+	if hit == nil {
+		chatUi.notice = "Only search results can be jumped to"
+		return
+	}
+
+	if tab := chatUi.findTab(hit.Message.Room, ""); tab != nil {
+		for i, local := range tab.box.messages {
+			if local.MessageId == hit.Message.MessageId {
+				chatUi.results = nil
+				chatUi.switchTab(chatUi.tabIndex(tab))
+				chatUi.selecting = true
+				chatUi.outputBox.selected = i
+				chatUi.outputBox.scrollToMessage(i)
+				return
+			}
+		}
+	}
+
+	context := chatUi.newPane(" Context of the search result" +
+		chatUi.keyHintsInParentheses(keyHint{"escape", "to go back"}) + " ")
+	for _, message := range hit.Before {
+		context.addMessage(&chatEntry{ChatMessage: message, label: resultLabel(message)})
+	}
+	context.addMessage(&chatEntry{ChatMessage: hit.Message, label: resultLabel(hit.Message)})
+	context.selected = len(context.messages) - 1
+	for _, message := range hit.After {
+		context.addMessage(&chatEntry{ChatMessage: message, label: resultLabel(message)})
+	}
+	chatUi.results = context
+	chatUi.relayout()
+	context.scrollToMessage(context.selected)
+}
@@ -0,0 +1,240 @@
+package nan0chat
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// number of results returned by a search that doesn't ask for a page size, and the most it may ask for
+const default_search_limit = 20
+const max_search_limit = 100
+
+// number of messages of the same room returned on each side of a search hit
+const search_context_messages = 2
+
+// number of messages in a page of history that doesn't ask for a page size, and the most it may ask for
+const default_history_limit = 50
+const max_history_limit = 200
+
+// Chat messages stored by the server in the order they arrived, along with an inverted index from every word
+// to the messages containing it
+type chatHistory struct {
+	mutex    sync.RWMutex
+	messages []*ChatMessage
+	deleted  map[int]bool
+	// position in messages of every message id
+	positions map[int64]int
+	// positions of the messages containing each lower case word, in ascending order
+	index map[string][]int
+}
+
+func newChatHistory() *chatHistory {
+	return &chatHistory{
+		deleted:   make(map[int]bool),
+		positions: make(map[int64]int),
+		index:     make(map[string][]int),
+	}
+}
+
+// Stores a posted message, or applies an edit or deletion to the message it targets
+func (h *chatHistory) add(message *ChatMessage) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	switch message.Action {
+	case ChatMessage_POST:
+		position := len(h.messages)
+		h.messages = append(h.messages, message)
+		h.positions[message.MessageId] = position
+		h.indexWords(position, message.Message)
+	case ChatMessage_EDIT:
+		// the stored message is replaced so that clients keep their own copy of the original
+		if position, ok := h.positions[message.TargetId]; ok && h.messages[position].UserId == message.UserId {
+			edited := *h.messages[position]
+			edited.Message = message.Message
+			h.messages[position] = &edited
+			// words no longer in the message stay indexed, matches are checked against the text when searching
+			h.indexWords(position, message.Message)
+		}
+	case ChatMessage_DELETE:
+		if position, ok := h.positions[message.TargetId]; ok && h.messages[position].UserId == message.UserId {
+			h.deleted[position] = true
+		}
+	}
+}
+
+// Adds the message at the given position to the index entry of every word in the text, keeping the entries in
+// ascending order without repeats. Edits add earlier positions.
+func (h *chatHistory) indexWords(position int, text string) {
+	for _, word := range searchWords(text) {
+		positions := h.index[word]
+		i := sort.SearchInts(positions, position)
+		if i < len(positions) && positions[i] == position {
+			continue
+		}
+		positions = append(positions, 0)
+		copy(positions[i+1:], positions[i:])
+		positions[i] = position
+		h.index[word] = positions
+	}
+}
+
+// Finds the messages containing every word of the query that pass the filters of the request, newest first.
+// Returns the requested page of hits and the total number of matching messages.
+func (h *chatHistory) search(request *SearchRequest) (hits []*SearchHit, total int) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	words := searchWords(request.Query)
+	var candidates []int
+	if len(words) == 0 {
+		// without a query every message passing the filters matches
+		candidates = make([]int, len(h.messages))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	} else {
+		candidates = h.index[words[0]]
+		for _, word := range words[1:] {
+			candidates = intersect(candidates, h.index[word])
+		}
+	}
+
+	limit := int(request.Limit)
+	if limit <= 0 {
+		limit = default_search_limit
+	}
+	if limit > max_search_limit {
+		limit = max_search_limit
+	}
+	offset := int(request.Offset)
+
+	for i := len(candidates) - 1; i >= 0; i-- {
+		position := candidates[i]
+		if !h.matches(position, words, request) {
+			continue
+		}
+		if total >= offset && len(hits) < limit {
+			hits = append(hits, h.hitAt(position))
+		}
+		total++
+	}
+	return
+}
+
+// Returns true if the message at the position still contains the words and passes the request filters
+func (h *chatHistory) matches(position int, words []string, request *SearchRequest) bool {
+	message := h.messages[position]
+	switch {
+	case h.deleted[position]:
+		return false
+	case request.UserName != "" && !strings.EqualFold(message.UserName, request.UserName):
+		return false
+	case request.Room != "" && message.Room != request.Room:
+		return false
+	case request.FromTime != 0 && message.Time < request.FromTime:
+		return false
+	case request.ToTime != 0 && message.Time > request.ToTime:
+		return false
+	}
+	// edited messages may no longer contain words they are indexed under
+	contained := searchWords(message.Message)
+	for _, word := range words {
+		if !containsWord(contained, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a page of the messages of the room sent before the message with the given id, oldest first, and
+// whether there are even older messages. A zero id returns the latest messages, an id that isn't stored returns
+// nothing as its place in the history is unknown.
+func (h *chatHistory) before(request *HistoryRequest) (messages []*ChatMessage, hasMore bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	limit := int(request.Limit)
+	if limit <= 0 {
+		limit = default_history_limit
+	}
+	if limit > max_history_limit {
+		limit = max_history_limit
+	}
+
+	end := len(h.messages)
+	if request.BeforeId != 0 {
+		position, ok := h.positions[request.BeforeId]
+		if !ok {
+			return nil, false
+		}
+		end = position
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if h.deleted[i] || h.messages[i].Room != request.Room {
+			continue
+		}
+		if len(messages) == limit {
+			return messages, true
+		}
+		messages = append([]*ChatMessage{h.messages[i]}, messages...)
+	}
+	return messages, false
+}
+
+// Returns the message at the position with a few messages of the same room on each side of it
+func (h *chatHistory) hitAt(position int) *SearchHit {
+	hit := &SearchHit{Message: h.messages[position]}
+	room := hit.Message.Room
+	for i := position - 1; i >= 0 && len(hit.Before) < search_context_messages; i-- {
+		if !h.deleted[i] && h.messages[i].Room == room {
+			hit.Before = append([]*ChatMessage{h.messages[i]}, hit.Before...)
+		}
+	}
+	for i := position + 1; i < len(h.messages) && len(hit.After) < search_context_messages; i++ {
+		if !h.deleted[i] && h.messages[i].Room == room {
+			hit.After = append(hit.After, h.messages[i])
+		}
+	}
+	return hit
+}
+
+// Splits text into the lower case words it is indexed and searched by, each word appears once
+func searchWords(text string) (words []string) {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(fields)
+	for i, field := range fields {
+		if i == 0 || fields[i-1] != field {
+			words = append(words, field)
+		}
+	}
+	return
+}
+
+// Returns true if the sorted words contain the word
+func containsWord(words []string, word string) bool {
+	i := sort.SearchStrings(words, word)
+	return i < len(words) && words[i] == word
+}
+
+// Returns the positions found in both ascending lists
+func intersect(a, b []int) (both []int) {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return
+}
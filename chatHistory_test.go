@@ -0,0 +1,28 @@
+package nan0chat
+
+import (
+	"testing"
+)
+
+func TestSearchFindsEditedMessageOnce(t *testing.T) {
+	h := newChatHistory()
+	h.add(&ChatMessage{MessageId: 1, UserId: 7, Message: "good morning"})
+	h.add(&ChatMessage{MessageId: 2, UserId: 7, Message: "hello there"})
+	h.add(&ChatMessage{Action: ChatMessage_EDIT, TargetId: 1, UserId: 7, Message: "hello world"})
+	// editing again must not index the message twice
+	h.add(&ChatMessage{Action: ChatMessage_EDIT, TargetId: 1, UserId: 7, Message: "hello world again"})
+
+	if positions := h.index["hello"]; len(positions) != 2 || positions[0] != 0 || positions[1] != 1 {
+		t.Errorf("index of hello = %v, want [0 1]", positions)
+	}
+	hits, total := h.search(&SearchRequest{Query: "hello"})
+	if total != 2 || len(hits) != 2 {
+		t.Fatalf("found %v hits of %v, want 2 of 2", len(hits), total)
+	}
+	if hits[0].Message.MessageId != 2 || hits[1].Message.MessageId != 1 {
+		t.Errorf("found messages %v and %v, want 2 and 1", hits[0].Message.MessageId, hits[1].Message.MessageId)
+	}
+	if hits, total := h.search(&SearchRequest{Query: "hello world"}); total != 1 || hits[0].Message.MessageId != 1 {
+		t.Errorf("found %v hits for hello world, want the edited message only", total)
+	}
+}
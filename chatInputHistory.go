@@ -0,0 +1,246 @@
+package nan0chat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// most lines kept in the input history, older lines are forgotten
+const max_input_history = 1000
+
+// Lines sent from the edit box, oldest first, which can be recalled into it again
+type inputHistory struct {
+	entries []string
+	// file the history is saved to, empty when it isn't saved
+	path string
+	// index in entries of the line recalled into the edit box, len(entries) while writing a new line
+	index int
+	// the line being written before recalling started, restored when moving past the latest entry
+	draft string
+}
+
+// State of a reverse incremental search of the input history
+type historySearch struct {
+	query string
+	// index in the history entries of the match shown in the edit box, -1 when nothing matches
+	match int
+	// contents of the edit box before the search started, restored when it is cancelled
+	draft string
+}
+
+// Opens the input history saved for the given server in the user's config directory. The history returned is
+// usable even along with an error, it is just empty or isn't saved.
+func openInputHistory(server string) (*inputHistory, error) {
+	dir, err := configDir()
+	if err != nil {
+		return &inputHistory{}, err
+	}
+	// host:port isn't a valid file name everywhere
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, server)
+	return loadInputHistory(filepath.Join(dir, "history", name))
+}
+
+// Loads the input history saved at the path, a missing file is an empty history
+func loadInputHistory(path string) (*inputHistory, error) {
+	history := &inputHistory{path: path}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return history, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// every entry is quoted on its own line, so entries may hold line breaks
+		if entry, err := strconv.Unquote(line); err == nil {
+			history.entries = append(history.entries, entry)
+		}
+	}
+	history.trim()
+	return history, nil
+}
+
+// Writes the entries to the file of the history, creating its directory if needed
+func (history *inputHistory) save() error {
+	if history.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(history.path), 0700); err != nil {
+		return err
+	}
+	var data strings.Builder
+	for _, entry := range history.entries {
+		data.WriteString(strconv.Quote(entry))
+		data.WriteByte('\n')
+	}
+	return ioutil.WriteFile(history.path, []byte(data.String()), 0600)
+}
+
+// Forgets the oldest entries beyond max_input_history and ends any recall
+func (history *inputHistory) trim() {
+	if len(history.entries) > max_input_history {
+		history.entries = history.entries[len(history.entries)-max_input_history:]
+	}
+	history.index = len(history.entries)
+	history.draft = ""
+}
+
+// Adds a sent line to the history and saves it, a line repeating the latest entry is only recalled once
+func (history *inputHistory) add(line string) error {
+	if line == "" || len(history.entries) > 0 && history.entries[len(history.entries)-1] == line {
+		history.trim()
+		return nil
+	}
+	history.entries = append(history.entries, line)
+	history.trim()
+	return history.save()
+}
+
+// Returns the entry before the one recalled, keeping the current line as the draft when recalling starts.
+// Returns false when there is no earlier entry.
+func (history *inputHistory) previous(current string) (string, bool) {
+	if history.index == 0 {
+		return "", false
+	}
+	if history.index == len(history.entries) {
+		history.draft = current
+	}
+	history.index--
+	return history.entries[history.index], true
+}
+
+// Returns the entry after the one recalled, or the draft after the latest entry. Returns false when no entry
+// is recalled.
+func (history *inputHistory) next() (string, bool) {
+	if history.index >= len(history.entries) {
+		return "", false
+	}
+	history.index++
+	if history.index == len(history.entries) {
+		return history.draft, true
+	}
+	return history.entries[history.index], true
+}
+
+// Returns the index of the latest entry at or before the given index containing the query, -1 when none does
+func (history *inputHistory) search(query string, from int) int {
+	for i := minInt(from, len(history.entries)-1); i >= 0; i-- {
+		if strings.Contains(history.entries[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replaces the edit box with the line sent before the one shown
+func (chatUi *ChatClientUI) recallPrevious() {
+	if line, ok := chatUi.history.previous(string(chatUi.editBox.text)); ok {
+		chatUi.editBox.SetText(line)
+	}
+}
+
+// Replaces the edit box with the line sent after the one shown, or with the line being written before recalling
+func (chatUi *ChatClientUI) recallNext() {
+	if line, ok := chatUi.history.next(); ok {
+		chatUi.editBox.SetText(line)
+	}
+}
+
+// Adds the sent line to the input history, telling the user when it couldn't be saved
+func (chatUi *ChatClientUI) remember(line string) {
+	if err := chatUi.history.add(line); err != nil {
+		chatUi.notice = fmt.Sprintf("Input history not saved: %v", err)
+	}
+}
+
+// Starts searching the input history backwards for the lines typed at the prompt
+func (chatUi *ChatClientUI) startHistorySearch() {
+	chatUi.historySearch = &historySearch{
+		match: -1,
+		draft: string(chatUi.editBox.text),
+	}
+}
+
+// Handles a key press while searching the input history, returning false for keys that end the search with
+// the match in the edit box and are then handled as usual. The keys bound to escape or cancel bring back the
+// draft, submit keeps the match, history-search finds an older match and delete-backward deletes from the query.
+func (chatUi *ChatClientUI) handleHistorySearchKey(ev termbox.Event) bool {
+	search := chatUi.historySearch
+	history := chatUi.history
+	switch chatUi.boundAction(ev) {
+	case "escape", "cancel":
+		chatUi.editBox.SetText(search.draft)
+		chatUi.historySearch = nil
+	case "submit":
+		// the match is left in the edit box to be changed or sent
+		chatUi.historySearch = nil
+	case "history-search":
+		// an older line containing the query
+		if search.match > 0 {
+			chatUi.showHistoryMatch(history.search(search.query, search.match-1))
+		}
+	case "delete-backward":
+		if search.query != "" {
+			runes := []rune(search.query)
+			search.query = string(runes[:len(runes)-1])
+			chatUi.showHistoryMatch(history.search(search.query, len(history.entries)-1))
+		}
+	default:
+		switch {
+		case ev.Key == termbox.KeySpace:
+			chatUi.extendHistorySearch(" ")
+		case ev.Ch == 0 || ev.Mod&termbox.ModAlt != 0:
+			chatUi.historySearch = nil
+			return false
+		default:
+			chatUi.extendHistorySearch(string(ev.Ch))
+		}
+	}
+	return true
+}
+
+// Adds to the query, keeping the match shown when it still contains the longer query
+func (chatUi *ChatClientUI) extendHistorySearch(text string) {
+	search := chatUi.historySearch
+	search.query += text
+	from := search.match
+	if from < 0 {
+		from = len(chatUi.history.entries) - 1
+	}
+	chatUi.showHistoryMatch(chatUi.history.search(search.query, from))
+}
+
+// Shows the entry at the index in the edit box, an index of -1 keeps the last match shown
+func (chatUi *ChatClientUI) showHistoryMatch(index int) {
+	if index < 0 {
+		if chatUi.historySearch.query == "" {
+			chatUi.historySearch.match = -1
+		}
+		return
+	}
+	chatUi.historySearch.match = index
+	chatUi.editBox.SetText(chatUi.history.entries[index])
+}
+
+// Returns the history search prompt shown below the edit box and the cell the cursor is placed at inside it
+func (chatUi *ChatClientUI) historySearchPrompt() (prompt string, cursor int) {
+	search := chatUi.historySearch
+	prompt = "History search: " + search.query
+	cursor = runewidth.StringWidth(prompt)
+	if search.query != "" && (search.match < 0 || !strings.Contains(chatUi.history.entries[search.match], search.query)) {
+		prompt += "  (no matches)"
+	}
+	hints := chatUi.keyHints(keyHint{"history-search", "older"}, keyHint{"submit", "done"},
+		keyHint{"escape", "cancel"})
+	return prompt + "  " + strings.Join(hints, ", "), cursor
+}
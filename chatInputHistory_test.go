@@ -0,0 +1,83 @@
+package nan0chat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInputHistorySavesAndLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "localhost_6865")
+	history, err := loadInputHistory(path)
+	if err != nil || len(history.entries) != 0 {
+		t.Fatalf("a missing file loaded %v entries (%v), want none", len(history.entries), err)
+	}
+	for _, line := range []string{"first", "two\nlines", "with \"quotes\"", "with \"quotes\"", ""} {
+		if err := history.add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := loadInputHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first", "two\nlines", "with \"quotes\""}
+	if fmt.Sprintf("%q", loaded.entries) != fmt.Sprintf("%q", want) {
+		t.Errorf("loaded %q, want %q", loaded.entries, want)
+	}
+	if loaded.index != len(want) {
+		t.Errorf("loaded history recalls entry %v, want none", loaded.index)
+	}
+}
+
+func TestInputHistoryKeepsTheLatestLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var data string
+	for i := 0; i < max_input_history+10; i++ {
+		data += fmt.Sprintf("%q\n", fmt.Sprint("line ", i))
+	}
+	// lines that aren't quoted are skipped
+	data += "not quoted\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	history, err := loadInputHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.entries) != max_input_history || history.entries[0] != "line 10" {
+		t.Errorf("loaded %v entries starting with %q, want %v starting with \"line 10\"", len(history.entries),
+			history.entries[0], max_input_history)
+	}
+}
+
+func TestInputHistoryRecall(t *testing.T) {
+	history := &inputHistory{entries: []string{"one", "two", "three"}, index: 3}
+	if line, ok := history.next(); ok {
+		t.Errorf("recalled %q after the latest entry", line)
+	}
+	for _, want := range []string{"three", "two", "one"} {
+		if line, ok := history.previous("draft"); !ok || line != want {
+			t.Errorf("recalled %q, want %q", line, want)
+		}
+	}
+	if _, ok := history.previous("one"); ok {
+		t.Errorf("recalled an entry before the first")
+	}
+	for _, want := range []string{"two", "three", "draft"} {
+		if line, ok := history.next(); !ok || line != want {
+			t.Errorf("recalled %q, want %q", line, want)
+		}
+	}
+	if i := history.search("o", 2); i != 1 {
+		t.Errorf("search found entry %v, want 1", i)
+	}
+	if i := history.search("o", 0); i != 0 {
+		t.Errorf("search found entry %v, want 0", i)
+	}
+	if i := history.search("four", 2); i != -1 {
+		t.Errorf("search found entry %v, want none", i)
+	}
+}
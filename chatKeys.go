@@ -0,0 +1,549 @@
+package nan0chat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// The keys of the edit box and the text area, one binding per line as a key and the action it runs. A key may
+// follow a prefix key, like Ctrl-E after Ctrl-X. The keys file uses the same format, its bindings are applied over
+// these.
+const default_key_bindings = `
+Esc           escape
+Ctrl-C        quit
+Ctrl-L        clear
+Up            up
+Down          down
+Alt-Up        scroll-up
+Alt-Down      scroll-down
+PgUp          page-up
+PgDn          page-down
+Home          top
+End           bottom
+Ctrl-O        select
+Ctrl-S        search
+Ctrl-G        cancel
+Ctrl-V        paste
+Left          backward-char
+Ctrl-B        backward-char
+Right         forward-char
+Ctrl-F        forward-char
+Backspace     delete-backward
+Ctrl-H        delete-backward
+Delete        delete-forward
+Ctrl-D        delete-forward
+Ctrl-K        kill-line
+Ctrl-U        kill-line-backward
+Alt-d         kill-word
+Ctrl-W        kill-word-backward
+Alt-Backspace kill-word-backward
+Alt-b         backward-word
+Alt-f         forward-word
+Ctrl-Y        yank
+Alt-y         yank-pop
+Ctrl-T        transpose
+Ctrl-_        undo
+Ctrl-Z        undo
+Alt-_         redo
+Ctrl-A        beginning-of-line
+Ctrl-E        end-of-line
+Tab           complete
+Ctrl-J        newline
+Alt-Enter     newline
+Enter         submit
+Ctrl-P        history-previous
+Ctrl-N        history-next
+Ctrl-R        history-search
+Ctrl-X Ctrl-E edit-in-editor
+Alt-1         tab-1
+Alt-2         tab-2
+Alt-3         tab-3
+Alt-4         tab-4
+Alt-5         tab-5
+Alt-6         tab-6
+Alt-7         tab-7
+Alt-8         tab-8
+Alt-9         tab-9
+Alt-n         next-tab
+Alt-Right     next-tab
+Alt-p         previous-tab
+Alt-Left      previous-tab
+`
+
+// A key press: either a special key or a character, with or without Alt
+type keyPress struct {
+	key termbox.Key
+	ch  rune
+	alt bool
+}
+
+// A key press as bound to an action
+type keyBinding struct {
+	keyPress
+	// the key pressed before it for a sequence such as Ctrl-X Ctrl-E, the zero key press for a single key
+	prefix keyPress
+}
+
+// Something the user can do with a key
+type keyAction struct {
+	name        string
+	description string
+	run         func(chatUi *ChatClientUI)
+}
+
+// The actions keys can be bound to, in the order /keys lists them
+var keyActions []keyAction
+
+// set up here because the commands list the actions through /keys while the submit action runs the commands
+func init() {
+	keyActions = []keyAction{
+		{"escape", "close the open pane, or leave the chat", (*ChatClientUI).escape},
+		{"quit", "leave the chat", func(chatUi *ChatClientUI) { chatUi.quitting = true }},
+		{"clear", "clear the messages of the tab shown and close the panes", (*ChatClientUI).clearMessages},
+		{"up", "move up a line of the message, recall the line sent before or scroll up", (*ChatClientUI).up},
+		{"down", "move down a line of the message, recall the line sent after or scroll down", (*ChatClientUI).down},
+		{"scroll-up", "scroll the text area up a line", func(chatUi *ChatClientUI) {
+			chatUi.scrollBoxUp(chatUi.activeOutputBox(), 1)
+		}},
+		{"scroll-down", "scroll the text area down a line", func(chatUi *ChatClientUI) {
+			chatUi.activeOutputBox().windowDown()
+		}},
+		{"page-up", "scroll the text area up a page", func(chatUi *ChatClientUI) {
+			chatUi.scrollBoxUp(chatUi.activeOutputBox(), chatUi.activeOutputBox().pageSize())
+		}},
+		{"page-down", "scroll the text area down a page", func(chatUi *ChatClientUI) {
+			chatUi.activeOutputBox().pageDown()
+		}},
+		{"top", "jump to the first message, loading older history there", func(chatUi *ChatClientUI) {
+			box := chatUi.activeOutputBox()
+			chatUi.scrollBoxUp(box, maxInt(box.windowTopIndex, 1))
+		}},
+		{"bottom", "jump to the latest message", func(chatUi *ChatClientUI) {
+			chatUi.activeOutputBox().scrollToBottom()
+		}},
+		{"select", "select a message", (*ChatClientUI).startSelecting},
+		{"search", "search the messages in the scrollback", func(chatUi *ChatClientUI) { chatUi.startSearch("") }},
+		{"cancel", "cancel the pending reply, reaction or edit", (*ChatClientUI).cancelPending},
+		{"paste", "paste the last copied text", func(chatUi *ChatClientUI) {
+			chatUi.editBox.InsertString(chatUi.clipboard)
+		}},
+		{"backward-char", "move the cursor back a character", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorOneRuneBackward()
+		}},
+		{"forward-char", "move the cursor forward a character", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorOneRuneForward()
+		}},
+		{"delete-backward", "delete the character before the cursor", func(chatUi *ChatClientUI) {
+			chatUi.editBox.DeleteRuneBackward()
+		}},
+		{"delete-forward", "delete the character under the cursor", func(chatUi *ChatClientUI) {
+			chatUi.editBox.DeleteRuneForward()
+		}},
+		{"kill-line", "delete the rest of the line, keeping it for yanking", func(chatUi *ChatClientUI) {
+			chatUi.kill(chatUi.editBox.DeleteTheRestOfTheLine(), false)
+		}},
+		{"kill-line-backward", "delete the line up to the cursor, keeping it for yanking", func(chatUi *ChatClientUI) {
+			chatUi.kill(chatUi.editBox.DeleteToBeginningOfTheLine(), true)
+		}},
+		{"kill-word", "delete to the end of the word, keeping it for yanking", func(chatUi *ChatClientUI) {
+			chatUi.kill(chatUi.editBox.DeleteWordForward(), false)
+		}},
+		{"kill-word-backward", "delete to the start of the word, keeping it for yanking", func(chatUi *ChatClientUI) {
+			chatUi.kill(chatUi.editBox.DeleteWordBackward(), true)
+		}},
+		{"backward-word", "move the cursor to the start of the word", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorWordBackward()
+		}},
+		{"forward-word", "move the cursor to the end of the word", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorWordForward()
+		}},
+		{"yank", "insert the text deleted last", (*ChatClientUI).yank},
+		{"yank-pop", "replace the text just inserted with the text deleted before it", (*ChatClientUI).yankPop},
+		{"transpose", "swap the characters around the cursor", func(chatUi *ChatClientUI) {
+			chatUi.editBox.TransposeRunes()
+		}},
+		{"undo", "undo the latest change of the message", func(chatUi *ChatClientUI) { chatUi.editBox.Undo() }},
+		{"redo", "redo the latest change undone", func(chatUi *ChatClientUI) { chatUi.editBox.Redo() }},
+		{"beginning-of-line", "move the cursor to the beginning of the line", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorToBeginningOfTheLine()
+		}},
+		{"end-of-line", "move the cursor to the end of the line", func(chatUi *ChatClientUI) {
+			chatUi.editBox.MoveCursorToEndOfTheLine()
+		}},
+		{"complete", "complete the command, user, room or emoji being typed", (*ChatClientUI).complete},
+		{"insert-tab", "insert a tab", func(chatUi *ChatClientUI) { chatUi.editBox.InsertRune('\t') }},
+		{"newline", "start a new line of the message", func(chatUi *ChatClientUI) { chatUi.editBox.InsertRune('\n') }},
+		{"submit", "send the message or run the command", (*ChatClientUI).submit},
+		{"history-previous", "recall the line sent before", (*ChatClientUI).recallPrevious},
+		{"history-next", "recall the line sent after", (*ChatClientUI).recallNext},
+		{"history-search", "search the lines sent before", (*ChatClientUI).startHistorySearch},
+		{"edit-in-editor", "write the message in $EDITOR", (*ChatClientUI).editInEditor},
+	}
+	for i := 0; i < 9; i++ {
+		tab := i
+		keyActions = append(keyActions, keyAction{fmt.Sprintf("tab-%v", tab+1),
+			fmt.Sprintf("show the tab at position %v", tab+1),
+			func(chatUi *ChatClientUI) { chatUi.switchTab(tab) }})
+	}
+	keyActions = append(keyActions,
+		keyAction{"next-tab", "show the next tab", func(chatUi *ChatClientUI) {
+			chatUi.switchTab((chatUi.activeTab + 1) % len(chatUi.tabs))
+		}},
+		keyAction{"previous-tab", "show the previous tab", func(chatUi *ChatClientUI) {
+			chatUi.switchTab((chatUi.activeTab + len(chatUi.tabs) - 1) % len(chatUi.tabs))
+		}},
+	)
+}
+
+// Names of the special keys, as written in the keys file
+var keyNames = []struct {
+	name string
+	key  termbox.Key
+}{
+	{"Esc", termbox.KeyEsc},
+	{"Enter", termbox.KeyEnter},
+	{"Tab", termbox.KeyTab},
+	{"Space", termbox.KeySpace},
+	{"Backspace", termbox.KeyBackspace2},
+	{"Ctrl-_", termbox.KeyCtrlUnderscore},
+	{"Delete", termbox.KeyDelete},
+	{"Insert", termbox.KeyInsert},
+	{"Up", termbox.KeyArrowUp},
+	{"Down", termbox.KeyArrowDown},
+	{"Left", termbox.KeyArrowLeft},
+	{"Right", termbox.KeyArrowRight},
+	{"PgUp", termbox.KeyPgup},
+	{"PgDn", termbox.KeyPgdn},
+	{"Home", termbox.KeyHome},
+	{"End", termbox.KeyEnd},
+	{"F1", termbox.KeyF1},
+	{"F2", termbox.KeyF2},
+	{"F3", termbox.KeyF3},
+	{"F4", termbox.KeyF4},
+	{"F5", termbox.KeyF5},
+	{"F6", termbox.KeyF6},
+	{"F7", termbox.KeyF7},
+	{"F8", termbox.KeyF8},
+	{"F9", termbox.KeyF9},
+	{"F10", termbox.KeyF10},
+	{"F11", termbox.KeyF11},
+	{"F12", termbox.KeyF12},
+}
+
+// Returns the key pressed
+func pressOf(ev termbox.Event) keyPress {
+	return keyPress{key: ev.Key, ch: ev.Ch, alt: ev.Mod&termbox.ModAlt != 0}
+}
+
+// Parses a key written like Ctrl-C, Alt-Enter, PgUp or x, or a prefix key and a key separated by a space like
+// Ctrl-X Ctrl-E
+func parseKey(text string) (binding keyBinding, err error) {
+	keys := strings.Split(text, " ")
+	if len(keys) > 2 {
+		return binding, fmt.Errorf("unknown key %q", text)
+	}
+	if len(keys) == 2 {
+		if binding.prefix, err = parseKeyPress(keys[0]); err != nil {
+			return
+		}
+	}
+	binding.keyPress, err = parseKeyPress(keys[len(keys)-1])
+	return
+}
+
+// Parses a single key. Names are not case sensitive, single characters are.
+func parseKeyPress(text string) (binding keyPress, err error) {
+	if len(text) > 4 && strings.EqualFold(text[:4], "alt-") {
+		binding.alt = true
+		text = text[4:]
+	}
+	if utf8.RuneCountInString(text) == 1 {
+		binding.ch, _ = utf8.DecodeRuneInString(text)
+		return
+	}
+	for _, name := range keyNames {
+		if strings.EqualFold(text, name.name) {
+			binding.key = name.key
+			return
+		}
+	}
+	if len(text) == 6 && strings.EqualFold(text[:5], "ctrl-") {
+		if letter := text[5] | 0x20; letter >= 'a' && letter <= 'z' {
+			binding.key = termbox.KeyCtrlA + termbox.Key(letter-'a')
+			return
+		}
+	}
+	return binding, fmt.Errorf("unknown key %q", text)
+}
+
+// Returns the key as written in the keys file
+func (binding keyBinding) String() string {
+	if binding.prefix != (keyPress{}) {
+		return binding.prefix.String() + " " + binding.keyPress.String()
+	}
+	return binding.keyPress.String()
+}
+
+// Returns the name of the key as written in the keys file
+func (binding keyPress) String() string {
+	prefix := ""
+	if binding.alt {
+		prefix = "Alt-"
+	}
+	if binding.ch != 0 {
+		return prefix + string(binding.ch)
+	}
+	for _, name := range keyNames {
+		if name.key == binding.key {
+			return prefix + name.name
+		}
+	}
+	if binding.key >= termbox.KeyCtrlA && binding.key <= termbox.KeyCtrlZ {
+		return prefix + "Ctrl-" + string(rune('A'+binding.key-termbox.KeyCtrlA))
+	}
+	return prefix + fmt.Sprintf("key %#x", uint16(binding.key))
+}
+
+// Returns the action with the given name, or nil when there is none
+func findKeyAction(name string) *keyAction {
+	for i := range keyActions {
+		if keyActions[i].name == name {
+			return &keyActions[i]
+		}
+	}
+	return nil
+}
+
+// Applies the bindings in the text to the map. Each line holds a key, or a prefix key and a key, and the action
+// it runs, or none to unbind the key; empty lines and lines starting with # are ignored.
+func parseKeyBindings(text string, bindings map[keyBinding]string) error {
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 && len(fields) != 3 {
+			return fmt.Errorf("line %v: expected a key and an action", i+1)
+		}
+		binding, err := parseKey(strings.Join(fields[:len(fields)-1], " "))
+		if err != nil {
+			return fmt.Errorf("line %v: %v", i+1, err)
+		}
+		action := fields[len(fields)-1]
+		switch {
+		case action == "none":
+			delete(bindings, binding)
+		case findKeyAction(action) != nil:
+			bindings[binding] = action
+		default:
+			return fmt.Errorf("line %v: unknown action %q", i+1, action)
+		}
+	}
+	return nil
+}
+
+// Returns the default bindings
+func defaultKeyBindings() map[keyBinding]string {
+	bindings := make(map[keyBinding]string)
+	if err := parseKeyBindings(default_key_bindings, bindings); err != nil {
+		panic(err)
+	}
+	return bindings
+}
+
+// Returns the default bindings changed by the keys file at the path, or in the user's config directory when the
+// path is empty. A missing keys file leaves the defaults, the bindings returned along with an error are too.
+func loadKeyBindings(path string) (map[keyBinding]string, error) {
+	bindings := defaultKeyBindings()
+	if path == "" {
+		dir, err := configDir()
+		if err != nil {
+			return bindings, nil
+		}
+		path = filepath.Join(dir, "keys")
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return bindings, nil
+	}
+	if err != nil {
+		return bindings, err
+	}
+	changed := defaultKeyBindings()
+	if err := parseKeyBindings(string(data), changed); err != nil {
+		return bindings, fmt.Errorf("%v %v", path, err)
+	}
+	return changed, nil
+}
+
+// Runs the action bound to the key press, returning false when no action is bound to it. An Alt key without a
+// binding of its own runs the action of the key without Alt. A prefix key waits for the key that follows it,
+// which is taken even when nothing is bound to the sequence.
+func (chatUi *ChatClientUI) runKeyAction(ev termbox.Event) bool {
+	binding := keyBinding{keyPress: pressOf(ev)}
+	if chatUi.keyPrefix != nil {
+		binding.prefix, chatUi.keyPrefix = *chatUi.keyPrefix, nil
+		if name, ok := chatUi.keyBindings[binding]; ok {
+			findKeyAction(name).run(chatUi)
+			chatUi.lastAction = name
+		} else {
+			chatUi.notice = binding.String() + " is not bound"
+		}
+		return true
+	}
+	if chatUi.isPrefixKey(binding.keyPress) {
+		chatUi.keyPrefix = &binding.keyPress
+		chatUi.notice = binding.String() + " -"
+		return true
+	}
+	name := chatUi.boundAction(ev)
+	if name == "" {
+		return false
+	}
+	findKeyAction(name).run(chatUi)
+	chatUi.lastAction = name
+	return true
+}
+
+// Returns the name of the action bound to the key press, or to the key without Alt, empty when none is. The
+// modes that take the keys, such as selecting and searching, give the actions meanings of their own.
+func (chatUi *ChatClientUI) boundAction(ev termbox.Event) string {
+	binding := keyBinding{keyPress: pressOf(ev)}
+	name, ok := chatUi.keyBindings[binding]
+	if !ok && binding.alt {
+		binding.alt = false
+		name = chatUi.keyBindings[binding]
+	}
+	return name
+}
+
+// Returns true when a sequence bound to an action starts with the key
+func (chatUi *ChatClientUI) isPrefixKey(press keyPress) bool {
+	if press == (keyPress{}) {
+		return false
+	}
+	for binding := range chatUi.keyBindings {
+		if binding.prefix == press {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the keys bound to the action, separated by slashes
+func (chatUi *ChatClientUI) keysOf(action string) string {
+	var keys []string
+	for binding, name := range chatUi.keyBindings {
+		if name == action {
+			keys = append(keys, binding.String())
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "/")
+}
+
+// An action named in a hint along with what its keys do there
+type keyHint struct {
+	action string
+	text   string
+}
+
+// Returns the keys of every hinted action followed by what they do, such as "Esc cancel", leaving out the
+// actions no key is bound to
+func (chatUi *ChatClientUI) keyHints(hints ...keyHint) (parts []string) {
+	for _, hint := range hints {
+		if keys := chatUi.keysOf(hint.action); keys != "" {
+			parts = append(parts, keys+" "+hint.text)
+		}
+	}
+	return
+}
+
+// Returns the hinted keys in parentheses, as shown after a hint or in a title, nothing when no key is bound
+func (chatUi *ChatClientUI) keyHintsInParentheses(hints ...keyHint) string {
+	if parts := chatUi.keyHints(hints...); len(parts) > 0 {
+		return " (" + strings.Join(parts, ", ") + ")"
+	}
+	return ""
+}
+
+// Returns the keys to quit, select and search as shown on the status bar. Escape doesn't quit in vi mode.
+func (chatUi *ChatClientUI) keysStatus() string {
+	quit := keyHint{"escape", "quit"}
+	if chatUi.vi != nil {
+		quit = keyHint{"quit", "quit"}
+	}
+	parts := chatUi.keyHints(quit, keyHint{"select", "select"}, keyHint{"search", "search"})
+	parts = append(parts, chatUi.keyHints(keyHint{"next-tab", "next tab"})...)
+	return strings.Join(append(parts, "/keys help"), ", ")
+}
+
+// Lists every action and the keys bound to it in a pane
+func (chatUi *ChatClientUI) listKeys(args string) {
+	pane := chatUi.newPane(" Keys, changed in the keys file of the config directory" +
+		chatUi.keyHintsInParentheses(keyHint{"escape", "to close"}) + " ")
+	for _, action := range keyActions {
+		keys := chatUi.keysOf(action.name)
+		if keys == "" {
+			keys = "-"
+		}
+		pane.addMessage(&chatEntry{
+			ChatMessage: &ChatMessage{Message: action.description},
+			label:       fmt.Sprintf("%-18v %-24v ", action.name, keys),
+		})
+	}
+	pane.scrollToTop()
+	chatUi.thread = nil
+	chatUi.results = pane
+	chatUi.relayout()
+}
+
+// Closes the open pane, or leaves the chat when none is open
+func (chatUi *ChatClientUI) escape() {
+	// an expanded thread or search results are closed before the application is
+	if chatUi.sidePane() != nil {
+		chatUi.closePane()
+		return
+	}
+	chatUi.quitting = true
+}
+
+// Clears the messages of the tab shown and closes the panes
+func (chatUi *ChatClientUI) clearMessages() {
+	chatUi.outputBox.clearMessages()
+	chatUi.thread = nil
+	chatUi.results = nil
+	chatUi.searchResults = nil
+	chatUi.relayout()
+}
+
+// Moves across the lines of a message being written, then recalls the lines sent before, unless the text area
+// is scrolled back or a pane is open in which case it scrolls up
+func (chatUi *ChatClientUI) up() {
+	switch {
+	case chatUi.editBox.MoveCursorLineUp():
+	case chatUi.scrollbackFocused():
+		chatUi.scrollBoxUp(chatUi.activeOutputBox(), 1)
+	default:
+		chatUi.recallPrevious()
+	}
+}
+
+// Moves across the lines of a message being written, then recalls the lines sent after, unless the text area
+// is scrolled back or a pane is open in which case it scrolls down
+func (chatUi *ChatClientUI) down() {
+	switch {
+	case chatUi.editBox.MoveCursorLineDown():
+	case chatUi.scrollbackFocused():
+		chatUi.activeOutputBox().windowDown()
+	default:
+		chatUi.recallNext()
+	}
+}
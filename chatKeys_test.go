@@ -0,0 +1,118 @@
+package nan0chat
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		text    string
+		binding keyBinding
+		written string
+	}{
+		{"x", keyBinding{keyPress: keyPress{ch: 'x'}}, "x"},
+		{"X", keyBinding{keyPress: keyPress{ch: 'X'}}, "X"},
+		{"é", keyBinding{keyPress: keyPress{ch: 'é'}}, "é"},
+		{"Alt-d", keyBinding{keyPress: keyPress{ch: 'd', alt: true}}, "Alt-d"},
+		{"alt-enter", keyBinding{keyPress: keyPress{key: termbox.KeyEnter, alt: true}}, "Alt-Enter"},
+		{"PGUP", keyBinding{keyPress: keyPress{key: termbox.KeyPgup}}, "PgUp"},
+		{"Ctrl-c", keyBinding{keyPress: keyPress{key: termbox.KeyCtrlC}}, "Ctrl-C"},
+		{"Ctrl-_", keyBinding{keyPress: keyPress{key: termbox.KeyCtrlUnderscore}}, "Ctrl-_"},
+		{"F12", keyBinding{keyPress: keyPress{key: termbox.KeyF12}}, "F12"},
+		{"Ctrl-X Ctrl-E", keyBinding{keyPress: keyPress{key: termbox.KeyCtrlE},
+			prefix: keyPress{key: termbox.KeyCtrlX}}, "Ctrl-X Ctrl-E"},
+	}
+	for _, test := range tests {
+		binding, err := parseKey(test.text)
+		if err != nil || binding != test.binding {
+			t.Errorf("parseKey(%q) = %+v, %v, want %+v", test.text, binding, err, test.binding)
+			continue
+		}
+		if written := binding.String(); written != test.written {
+			t.Errorf("%q is written %q, want %q", test.text, written, test.written)
+		}
+	}
+	for _, text := range []string{"", "Ctrl-1", "Hyper-x", "abc", "Ctrl-X Ctrl-E Ctrl-S", "Alt-"} {
+		if binding, err := parseKey(text); err == nil {
+			t.Errorf("parseKey(%q) = %+v, want an error", text, binding)
+		}
+	}
+}
+
+func TestParseKeyBindings(t *testing.T) {
+	bindings := defaultKeyBindings()
+	err := parseKeyBindings(`
+# comments and empty lines are skipped
+
+Ctrl-Q  quit
+Ctrl-C  none
+Ctrl-X s search
+`, bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := func(key termbox.Key) keyBinding { return keyBinding{keyPress: keyPress{key: key}} }
+	if name := bindings[ctrl(termbox.KeyCtrlQ)]; name != "quit" {
+		t.Errorf("Ctrl-Q runs %q, want quit", name)
+	}
+	if name, ok := bindings[ctrl(termbox.KeyCtrlC)]; ok {
+		t.Errorf("Ctrl-C still runs %q", name)
+	}
+	sequence := keyBinding{keyPress: keyPress{ch: 's'}, prefix: keyPress{key: termbox.KeyCtrlX}}
+	if name := bindings[sequence]; name != "search" {
+		t.Errorf("Ctrl-X s runs %q, want search", name)
+	}
+	if name := bindings[ctrl(termbox.KeyCtrlL)]; name != "clear" {
+		t.Errorf("Ctrl-L runs %q, want the default clear", name)
+	}
+
+	for _, text := range []string{"Ctrl-Q", "Ctrl-Q quit now please", "Ctrl-1 quit", "Ctrl-Q leave"} {
+		if err := parseKeyBindings("# first\n"+text, defaultKeyBindings()); err == nil {
+			t.Errorf("%q parsed without an error", text)
+		} else if err.Error()[:7] != "line 2:" {
+			t.Errorf("%q gave %q, want the error on line 2", text, err)
+		}
+	}
+}
+
+func TestLoadKeyBindings(t *testing.T) {
+	dir := t.TempDir()
+	bindings, err := loadKeyBindings(filepath.Join(dir, "missing"))
+	if err != nil || len(bindings) != len(defaultKeyBindings()) {
+		t.Errorf("a missing keys file gave %v bindings (%v), want the defaults", len(bindings), err)
+	}
+
+	path := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(path, []byte("Ctrl-Q quit\nCtrl-C leave\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bindings, err = loadKeyBindings(path)
+	if err == nil {
+		t.Errorf("a keys file with an unknown action loaded without an error")
+	}
+	if _, ok := bindings[keyBinding{keyPress: keyPress{key: termbox.KeyCtrlQ}}]; ok {
+		t.Errorf("a keys file with an error was applied in part")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("Ctrl-Q quit\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if bindings, err = loadKeyBindings(path); err != nil || bindings[keyBinding{keyPress: keyPress{key: termbox.KeyCtrlQ}}] != "quit" {
+		t.Errorf("the keys file wasn't applied (%v)", err)
+	}
+}
+
+// Bindings find actions by name, so no two actions may share one
+func TestKeyActionNamesAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, action := range keyActions {
+		if seen[action.name] {
+			t.Errorf("action %q is listed twice", action.name)
+		}
+		seen[action.name] = true
+	}
+}
@@ -0,0 +1,122 @@
+package nan0chat
+
+// rows below the output box: its bottom border, a single line edit box with its borders, the hint and the
+// status bar
+const layout_bottom_rows = 6
+
+// terminals at least this wide show an open pane next to the output box instead of in its place
+const side_pane_min_width = 140
+
+// smallest output box drawn, smaller terminals clip the ui instead of shrinking it further
+const min_output_width = 20
+const min_output_height = 3
+
+// Positions and sizes of the ui elements, computed from the terminal size
+type chatLayout struct {
+	tabBarY                                     int
+	outputX, outputY, outputWidth, outputHeight int
+	// location of the side pane, sideWidth is 0 when no side pane is shown
+	sideX, sideWidth                    int
+	editX, editY, editWidth, editHeight int
+	hintY, statusY                      int
+}
+
+// Computes the location of every ui element for a terminal of the given size, leaving room for a side pane
+// when one is wanted and the terminal is wide enough for it. The output box gives up the rows taken by the
+// edit box beyond its first line.
+func computeLayout(width, height int, sidePane bool, editHeight int) (l chatLayout) {
+	// the tab bar takes the top row, the output box starts inside its top left border below it
+	l.tabBarY = 0
+	l.outputX, l.outputY = 1, 2
+	l.outputWidth = maxInt(width-2, min_output_width)
+	l.outputHeight = maxInt(height-l.outputY-layout_bottom_rows-(editHeight-1), min_output_height)
+
+	if sidePane && width >= side_pane_min_width {
+		// the output box keeps three fifths of the width, the side pane has its own borders
+		l.sideWidth = (l.outputWidth - 3) * 2 / 5
+		l.outputWidth -= l.sideWidth + 3
+		l.sideX = l.outputX + l.outputWidth + 3
+	}
+
+	// the edit box spans the whole width below the output box
+	l.editX = l.outputX
+	l.editY = l.outputY + l.outputHeight + 2
+	l.editWidth = maxInt(width-2, min_output_width)
+	l.editHeight = editHeight
+	l.hintY = l.editY + editHeight + 1
+	l.statusY = l.editY + editHeight + 2
+	return
+}
+
+// Lays the ui out for a terminal of the given size, rewrapping the messages of every output box
+func (chatUi *ChatClientUI) resize(width, height int) {
+	chatUi.termWidth, chatUi.termHeight = width, height
+	pane := chatUi.sidePane()
+	chatUi.layout = computeLayout(width, height, pane != nil, chatUi.editBox.Height())
+	chatUi.editBoxWidth = chatUi.layout.editWidth
+	for _, tab := range chatUi.tabs {
+		tab.box.resize(chatUi.layout.outputWidth, chatUi.layout.outputHeight)
+	}
+	if pane == nil {
+		return
+	}
+	if chatUi.layout.sideWidth > 0 {
+		pane.resize(chatUi.layout.sideWidth, chatUi.layout.outputHeight)
+	} else {
+		pane.resize(chatUi.layout.outputWidth, chatUi.layout.outputHeight)
+	}
+}
+
+// Lays the ui out again for the current terminal size, used when panes open or close
+func (chatUi *ChatClientUI) relayout() {
+	chatUi.resize(chatUi.termWidth, chatUi.termHeight)
+}
+
+// Changes the size of the output box, rewrapping its messages to the new width. The message at the top of
+// the drawing window stays there unless the window was following the latest messages.
+func (outputBox *OutputBox) resize(width, height int) {
+	if width == outputBox.width && height == outputBox.height {
+		return
+	}
+	following := outputBox.windowBottomIndex >= len(outputBox.lines)
+	var top *chatEntry
+	if outputBox.windowTopIndex < len(outputBox.lines) {
+		top = outputBox.lines[outputBox.windowTopIndex].message
+	}
+
+	outputBox.width = width
+	outputBox.height = height
+	outputBox.rebuildLines()
+
+	outputBox.windowTopIndex = 0
+	for i, line := range outputBox.lines {
+		if top != nil && line.message == top {
+			outputBox.windowTopIndex = i
+			break
+		}
+	}
+	outputBox.windowBottomIndex = outputBox.windowTopIndex + height - 1
+	if following {
+		for outputBox.windowBottomIndex < len(outputBox.lines) {
+			outputBox.windowDown()
+		}
+	}
+	// never leave empty space below the last line when there are earlier lines to show
+	for outputBox.windowBottomIndex > len(outputBox.lines) && outputBox.windowTopIndex > 0 {
+		outputBox.windowUp()
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -18,6 +18,64 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type ChatMessage_Action int32
+
+const (
+	ChatMessage_POST   ChatMessage_Action = 0
+	ChatMessage_EDIT   ChatMessage_Action = 1
+	ChatMessage_DELETE ChatMessage_Action = 2
+	ChatMessage_REACT  ChatMessage_Action = 3
+)
+
+var ChatMessage_Action_name = map[int32]string{
+	0: "POST",
+	1: "EDIT",
+	2: "DELETE",
+	3: "REACT",
+}
+var ChatMessage_Action_value = map[string]int32{
+	"POST":   0,
+	"EDIT":   1,
+	"DELETE": 2,
+	"REACT":  3,
+}
+
+func (x ChatMessage_Action) String() string {
+	return proto.EnumName(ChatMessage_Action_name, int32(x))
+}
+func (ChatMessage_Action) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{1, 0}
+}
+
+type Presence_State int32
+
+const (
+	Presence_ONLINE  Presence_State = 0
+	Presence_JOIN    Presence_State = 1
+	Presence_PART    Presence_State = 2
+	Presence_OFFLINE Presence_State = 3
+)
+
+var Presence_State_name = map[int32]string{
+	0: "ONLINE",
+	1: "JOIN",
+	2: "PART",
+	3: "OFFLINE",
+}
+var Presence_State_value = map[string]int32{
+	"ONLINE":  0,
+	"JOIN":    1,
+	"PART":    2,
+	"OFFLINE": 3,
+}
+
+func (x Presence_State) String() string {
+	return proto.EnumName(Presence_State_name, int32(x))
+}
+func (Presence_State) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{2, 0}
+}
+
 type User struct {
 	UserId               int64    `protobuf:"varint,1,opt,name=userId,proto3" json:"userId,omitempty"`
 	UserName             string   `protobuf:"bytes,2,opt,name=userName,proto3" json:"userName,omitempty"`
@@ -30,7 +88,7 @@ func (m *User) Reset()         { *m = User{} }
 func (m *User) String() string { return proto.CompactTextString(m) }
 func (*User) ProtoMessage()    {}
 func (*User) Descriptor() ([]byte, []int) {
-	return fileDescriptor_chatMessaging_94440c24f04fc7f9, []int{0}
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{0}
 }
 func (m *User) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_User.Unmarshal(m, b)
@@ -65,20 +123,26 @@ func (m *User) GetUserName() string {
 }
 
 type ChatMessage struct {
-	UserId               int64    `protobuf:"varint,3,opt,name=userId,proto3" json:"userId,omitempty"`
-	MessageId            int64    `protobuf:"varint,4,opt,name=messageId,proto3" json:"messageId,omitempty"`
-	Time                 int64    `protobuf:"varint,5,opt,name=time,proto3" json:"time,omitempty"`
-	Message              string   `protobuf:"bytes,6,opt,name=message,proto3" json:"message,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	UserId               int64              `protobuf:"varint,3,opt,name=userId,proto3" json:"userId,omitempty"`
+	MessageId            int64              `protobuf:"varint,4,opt,name=messageId,proto3" json:"messageId,omitempty"`
+	Time                 int64              `protobuf:"varint,5,opt,name=time,proto3" json:"time,omitempty"`
+	Message              string             `protobuf:"bytes,6,opt,name=message,proto3" json:"message,omitempty"`
+	ReplyTo              int64              `protobuf:"varint,7,opt,name=replyTo,proto3" json:"replyTo,omitempty"`
+	Action               ChatMessage_Action `protobuf:"varint,8,opt,name=action,proto3,enum=nan0chat.ChatMessage.Action" json:"action,omitempty"`
+	TargetId             int64              `protobuf:"varint,9,opt,name=targetId,proto3" json:"targetId,omitempty"`
+	UserName             string             `protobuf:"bytes,10,opt,name=userName,proto3" json:"userName,omitempty"`
+	Room                 string             `protobuf:"bytes,11,opt,name=room,proto3" json:"room,omitempty"`
+	Recipient            string             `protobuf:"bytes,12,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
 }
 
 func (m *ChatMessage) Reset()         { *m = ChatMessage{} }
 func (m *ChatMessage) String() string { return proto.CompactTextString(m) }
 func (*ChatMessage) ProtoMessage()    {}
 func (*ChatMessage) Descriptor() ([]byte, []int) {
-	return fileDescriptor_chatMessaging_94440c24f04fc7f9, []int{1}
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{1}
 }
 func (m *ChatMessage) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ChatMessage.Unmarshal(m, b)
@@ -126,24 +190,554 @@ func (m *ChatMessage) GetMessage() string {
 	return ""
 }
 
+func (m *ChatMessage) GetReplyTo() int64 {
+	if m != nil {
+		return m.ReplyTo
+	}
+	return 0
+}
+
+func (m *ChatMessage) GetAction() ChatMessage_Action {
+	if m != nil {
+		return m.Action
+	}
+	return ChatMessage_POST
+}
+
+func (m *ChatMessage) GetTargetId() int64 {
+	if m != nil {
+		return m.TargetId
+	}
+	return 0
+}
+
+func (m *ChatMessage) GetUserName() string {
+	if m != nil {
+		return m.UserName
+	}
+	return ""
+}
+
+func (m *ChatMessage) GetRoom() string {
+	if m != nil {
+		return m.Room
+	}
+	return ""
+}
+
+func (m *ChatMessage) GetRecipient() string {
+	if m != nil {
+		return m.Recipient
+	}
+	return ""
+}
+
+type Presence struct {
+	UserId               int64          `protobuf:"varint,1,opt,name=userId,proto3" json:"userId,omitempty"`
+	UserName             string         `protobuf:"bytes,2,opt,name=userName,proto3" json:"userName,omitempty"`
+	State                Presence_State `protobuf:"varint,3,opt,name=state,proto3,enum=nan0chat.Presence.State" json:"state,omitempty"`
+	Room                 string         `protobuf:"bytes,4,opt,name=room,proto3" json:"room,omitempty"`
+	Users                []string       `protobuf:"bytes,5,rep,name=users,proto3" json:"users,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *Presence) Reset()         { *m = Presence{} }
+func (m *Presence) String() string { return proto.CompactTextString(m) }
+func (*Presence) ProtoMessage()    {}
+func (*Presence) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{2}
+}
+func (m *Presence) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Presence.Unmarshal(m, b)
+}
+func (m *Presence) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Presence.Marshal(b, m, deterministic)
+}
+func (dst *Presence) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Presence.Merge(dst, src)
+}
+func (m *Presence) XXX_Size() int {
+	return xxx_messageInfo_Presence.Size(m)
+}
+func (m *Presence) XXX_DiscardUnknown() {
+	xxx_messageInfo_Presence.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Presence proto.InternalMessageInfo
+
+func (m *Presence) GetUserId() int64 {
+	if m != nil {
+		return m.UserId
+	}
+	return 0
+}
+
+func (m *Presence) GetUserName() string {
+	if m != nil {
+		return m.UserName
+	}
+	return ""
+}
+
+func (m *Presence) GetState() Presence_State {
+	if m != nil {
+		return m.State
+	}
+	return Presence_ONLINE
+}
+
+func (m *Presence) GetRoom() string {
+	if m != nil {
+		return m.Room
+	}
+	return ""
+}
+
+func (m *Presence) GetUsers() []string {
+	if m != nil {
+		return m.Users
+	}
+	return nil
+}
+
+type SearchRequest struct {
+	RequestId            int64    `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Query                string   `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	UserName             string   `protobuf:"bytes,3,opt,name=userName,proto3" json:"userName,omitempty"`
+	Room                 string   `protobuf:"bytes,4,opt,name=room,proto3" json:"room,omitempty"`
+	FromTime             int64    `protobuf:"varint,5,opt,name=fromTime,proto3" json:"fromTime,omitempty"`
+	ToTime               int64    `protobuf:"varint,6,opt,name=toTime,proto3" json:"toTime,omitempty"`
+	Offset               int32    `protobuf:"varint,7,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit                int32    `protobuf:"varint,8,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SearchRequest) Reset()         { *m = SearchRequest{} }
+func (m *SearchRequest) String() string { return proto.CompactTextString(m) }
+func (*SearchRequest) ProtoMessage()    {}
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{3}
+}
+func (m *SearchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchRequest.Unmarshal(m, b)
+}
+func (m *SearchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchRequest.Marshal(b, m, deterministic)
+}
+func (dst *SearchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchRequest.Merge(dst, src)
+}
+func (m *SearchRequest) XXX_Size() int {
+	return xxx_messageInfo_SearchRequest.Size(m)
+}
+func (m *SearchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchRequest proto.InternalMessageInfo
+
+func (m *SearchRequest) GetRequestId() int64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetUserName() string {
+	if m != nil {
+		return m.UserName
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetRoom() string {
+	if m != nil {
+		return m.Room
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetFromTime() int64 {
+	if m != nil {
+		return m.FromTime
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetToTime() int64 {
+	if m != nil {
+		return m.ToTime
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetOffset() int32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type SearchHit struct {
+	Message              *ChatMessage   `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Before               []*ChatMessage `protobuf:"bytes,2,rep,name=before,proto3" json:"before,omitempty"`
+	After                []*ChatMessage `protobuf:"bytes,3,rep,name=after,proto3" json:"after,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SearchHit) Reset()         { *m = SearchHit{} }
+func (m *SearchHit) String() string { return proto.CompactTextString(m) }
+func (*SearchHit) ProtoMessage()    {}
+func (*SearchHit) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{4}
+}
+func (m *SearchHit) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchHit.Unmarshal(m, b)
+}
+func (m *SearchHit) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchHit.Marshal(b, m, deterministic)
+}
+func (dst *SearchHit) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchHit.Merge(dst, src)
+}
+func (m *SearchHit) XXX_Size() int {
+	return xxx_messageInfo_SearchHit.Size(m)
+}
+func (m *SearchHit) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchHit.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchHit proto.InternalMessageInfo
+
+func (m *SearchHit) GetMessage() *ChatMessage {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+func (m *SearchHit) GetBefore() []*ChatMessage {
+	if m != nil {
+		return m.Before
+	}
+	return nil
+}
+
+func (m *SearchHit) GetAfter() []*ChatMessage {
+	if m != nil {
+		return m.After
+	}
+	return nil
+}
+
+type SearchResponse struct {
+	RequestId            int64        `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Hits                 []*SearchHit `protobuf:"bytes,2,rep,name=hits,proto3" json:"hits,omitempty"`
+	Total                int32        `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`
+	Offset               int32        `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *SearchResponse) Reset()         { *m = SearchResponse{} }
+func (m *SearchResponse) String() string { return proto.CompactTextString(m) }
+func (*SearchResponse) ProtoMessage()    {}
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{5}
+}
+func (m *SearchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchResponse.Unmarshal(m, b)
+}
+func (m *SearchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchResponse.Marshal(b, m, deterministic)
+}
+func (dst *SearchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchResponse.Merge(dst, src)
+}
+func (m *SearchResponse) XXX_Size() int {
+	return xxx_messageInfo_SearchResponse.Size(m)
+}
+func (m *SearchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchResponse proto.InternalMessageInfo
+
+func (m *SearchResponse) GetRequestId() int64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *SearchResponse) GetHits() []*SearchHit {
+	if m != nil {
+		return m.Hits
+	}
+	return nil
+}
+
+func (m *SearchResponse) GetTotal() int32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *SearchResponse) GetOffset() int32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type HistoryRequest struct {
+	RequestId            int64    `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Room                 string   `protobuf:"bytes,2,opt,name=room,proto3" json:"room,omitempty"`
+	BeforeId             int64    `protobuf:"varint,3,opt,name=beforeId,proto3" json:"beforeId,omitempty"`
+	Limit                int32    `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HistoryRequest) Reset()         { *m = HistoryRequest{} }
+func (m *HistoryRequest) String() string { return proto.CompactTextString(m) }
+func (*HistoryRequest) ProtoMessage()    {}
+func (*HistoryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{6}
+}
+func (m *HistoryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HistoryRequest.Unmarshal(m, b)
+}
+func (m *HistoryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HistoryRequest.Marshal(b, m, deterministic)
+}
+func (dst *HistoryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HistoryRequest.Merge(dst, src)
+}
+func (m *HistoryRequest) XXX_Size() int {
+	return xxx_messageInfo_HistoryRequest.Size(m)
+}
+func (m *HistoryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HistoryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HistoryRequest proto.InternalMessageInfo
+
+func (m *HistoryRequest) GetRequestId() int64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *HistoryRequest) GetRoom() string {
+	if m != nil {
+		return m.Room
+	}
+	return ""
+}
+
+func (m *HistoryRequest) GetBeforeId() int64 {
+	if m != nil {
+		return m.BeforeId
+	}
+	return 0
+}
+
+func (m *HistoryRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type HistoryResponse struct {
+	RequestId            int64          `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Room                 string         `protobuf:"bytes,2,opt,name=room,proto3" json:"room,omitempty"`
+	Messages             []*ChatMessage `protobuf:"bytes,3,rep,name=messages,proto3" json:"messages,omitempty"`
+	HasMore              bool           `protobuf:"varint,4,opt,name=hasMore,proto3" json:"hasMore,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *HistoryResponse) Reset()         { *m = HistoryResponse{} }
+func (m *HistoryResponse) String() string { return proto.CompactTextString(m) }
+func (*HistoryResponse) ProtoMessage()    {}
+func (*HistoryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{7}
+}
+func (m *HistoryResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HistoryResponse.Unmarshal(m, b)
+}
+func (m *HistoryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HistoryResponse.Marshal(b, m, deterministic)
+}
+func (dst *HistoryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HistoryResponse.Merge(dst, src)
+}
+func (m *HistoryResponse) XXX_Size() int {
+	return xxx_messageInfo_HistoryResponse.Size(m)
+}
+func (m *HistoryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HistoryResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HistoryResponse proto.InternalMessageInfo
+
+func (m *HistoryResponse) GetRequestId() int64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *HistoryResponse) GetRoom() string {
+	if m != nil {
+		return m.Room
+	}
+	return ""
+}
+
+func (m *HistoryResponse) GetMessages() []*ChatMessage {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+func (m *HistoryResponse) GetHasMore() bool {
+	if m != nil {
+		return m.HasMore
+	}
+	return false
+}
+
+type Ping struct {
+	RequestId            int64    `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Time                 int64    `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Ping) Reset()         { *m = Ping{} }
+func (m *Ping) String() string { return proto.CompactTextString(m) }
+func (*Ping) ProtoMessage()    {}
+func (*Ping) Descriptor() ([]byte, []int) {
+	return fileDescriptor_chatMessaging_d675d117e37cc1d2, []int{8}
+}
+func (m *Ping) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Ping.Unmarshal(m, b)
+}
+func (m *Ping) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Ping.Marshal(b, m, deterministic)
+}
+func (dst *Ping) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Ping.Merge(dst, src)
+}
+func (m *Ping) XXX_Size() int {
+	return xxx_messageInfo_Ping.Size(m)
+}
+func (m *Ping) XXX_DiscardUnknown() {
+	xxx_messageInfo_Ping.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Ping proto.InternalMessageInfo
+
+func (m *Ping) GetRequestId() int64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *Ping) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*User)(nil), "nan0chat.User")
 	proto.RegisterType((*ChatMessage)(nil), "nan0chat.ChatMessage")
+	proto.RegisterType((*Presence)(nil), "nan0chat.Presence")
+	proto.RegisterType((*SearchRequest)(nil), "nan0chat.SearchRequest")
+	proto.RegisterType((*SearchHit)(nil), "nan0chat.SearchHit")
+	proto.RegisterType((*SearchResponse)(nil), "nan0chat.SearchResponse")
+	proto.RegisterType((*HistoryRequest)(nil), "nan0chat.HistoryRequest")
+	proto.RegisterType((*HistoryResponse)(nil), "nan0chat.HistoryResponse")
+	proto.RegisterType((*Ping)(nil), "nan0chat.Ping")
+	proto.RegisterEnum("nan0chat.ChatMessage.Action", ChatMessage_Action_name, ChatMessage_Action_value)
+	proto.RegisterEnum("nan0chat.Presence.State", Presence_State_name, Presence_State_value)
 }
 
-func init() { proto.RegisterFile("chatMessaging.proto", fileDescriptor_chatMessaging_94440c24f04fc7f9) }
-
-var fileDescriptor_chatMessaging_94440c24f04fc7f9 = []byte{
-	// 162 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x4e, 0xce, 0x48, 0x2c,
-	0xf1, 0x4d, 0x2d, 0x2e, 0x4e, 0x4c, 0xcf, 0xcc, 0x4b, 0xd7, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17,
-	0xe2, 0xc8, 0x4b, 0xcc, 0x33, 0x00, 0x49, 0x28, 0x59, 0x71, 0xb1, 0x84, 0x16, 0xa7, 0x16, 0x09,
-	0x89, 0x71, 0xb1, 0x95, 0x16, 0xa7, 0x16, 0x79, 0xa6, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x30, 0x07,
-	0x41, 0x79, 0x42, 0x52, 0x5c, 0x1c, 0x20, 0x96, 0x5f, 0x62, 0x6e, 0xaa, 0x04, 0x93, 0x02, 0xa3,
-	0x06, 0x67, 0x10, 0x9c, 0xaf, 0x54, 0xc8, 0xc5, 0xed, 0x0c, 0x37, 0x3c, 0x15, 0xc9, 0x08, 0x66,
-	0x14, 0x23, 0x64, 0xb8, 0x38, 0x73, 0x21, 0x4a, 0x3c, 0x53, 0x24, 0x58, 0xc0, 0x52, 0x08, 0x01,
-	0x21, 0x21, 0x2e, 0x96, 0x92, 0xcc, 0xdc, 0x54, 0x09, 0x56, 0xb0, 0x04, 0x98, 0x2d, 0x24, 0xc1,
-	0xc5, 0x0e, 0x55, 0x20, 0xc1, 0x06, 0xb6, 0x13, 0xc6, 0x75, 0xe2, 0x8a, 0x82, 0x3b, 0x3d, 0x89,
-	0x0d, 0xec, 0x17, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0xc7, 0xfc, 0x61, 0xe0, 0xe2, 0x00,
-	0x00, 0x00,
+func init() { proto.RegisterFile("chatMessaging.proto", fileDescriptor_chatMessaging_d675d117e37cc1d2) }
+
+var fileDescriptor_chatMessaging_d675d117e37cc1d2 = []byte{
+	// 635 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0x3f, 0x6f, 0xdb, 0x3e,
+	0x10, 0xfd, 0xc9, 0xfa, 0x13, 0xf9, 0xfc, 0xab, 0x6b, 0x30, 0x6d, 0x41, 0x04, 0x19, 0x0c, 0x2d,
+	0x35, 0x50, 0xd4, 0x6d, 0x93, 0x0c, 0x45, 0xb7, 0x34, 0x51, 0x10, 0x15, 0x89, 0x1d, 0x30, 0xea,
+	0xd2, 0x4d, 0x71, 0x68, 0x5b, 0x40, 0x24, 0x3a, 0x24, 0x33, 0xe4, 0x03, 0x74, 0xef, 0xd8, 0x4f,
+	0xd5, 0xad, 0x7b, 0x3f, 0x4a, 0x41, 0x52, 0xa2, 0x64, 0x20, 0xff, 0xd0, 0x8d, 0x8f, 0xf7, 0x78,
+	0xbc, 0x77, 0xef, 0x70, 0xb0, 0x39, 0x5b, 0x66, 0xf2, 0x94, 0x0a, 0x91, 0x2d, 0xf2, 0x72, 0x31,
+	0x5e, 0x71, 0x26, 0x19, 0x0a, 0xcb, 0xac, 0x7c, 0xaf, 0x02, 0xd1, 0x27, 0xf0, 0xbe, 0x0a, 0xca,
+	0xd1, 0x2b, 0x08, 0x6e, 0x04, 0xe5, 0xc9, 0x25, 0x76, 0x86, 0xce, 0xc8, 0x25, 0x15, 0x42, 0x5b,
+	0x10, 0xaa, 0xd3, 0x24, 0x2b, 0x28, 0xee, 0x0c, 0x9d, 0x51, 0x97, 0x58, 0x1c, 0xfd, 0xe9, 0x40,
+	0xef, 0xc0, 0x66, 0xa7, 0xad, 0x1c, 0xee, 0x5a, 0x8e, 0x6d, 0xe8, 0x16, 0x86, 0x92, 0x5c, 0x62,
+	0x4f, 0x87, 0x9a, 0x0b, 0x84, 0xc0, 0x93, 0x79, 0x41, 0xb1, 0xaf, 0x03, 0xfa, 0x8c, 0x30, 0x6c,
+	0x54, 0x04, 0x1c, 0xe8, 0x4f, 0x6b, 0xa8, 0x22, 0x9c, 0xae, 0xae, 0x6e, 0x53, 0x86, 0x37, 0xf4,
+	0x83, 0x1a, 0xa2, 0x3d, 0x08, 0xb2, 0x99, 0xcc, 0x59, 0x89, 0xc3, 0xa1, 0x33, 0xea, 0xef, 0x6c,
+	0x8f, 0x6b, 0x91, 0xe3, 0x56, 0x91, 0xe3, 0x7d, 0xcd, 0x21, 0x15, 0x57, 0xe9, 0x93, 0x19, 0x5f,
+	0x50, 0x99, 0x5c, 0xe2, 0xae, 0x4e, 0x68, 0xf1, 0x9a, 0x76, 0x58, 0xd7, 0xae, 0xaa, 0xe6, 0x8c,
+	0x15, 0xb8, 0xa7, 0xef, 0xf5, 0x59, 0xe9, 0xe4, 0x74, 0x96, 0xaf, 0x72, 0x5a, 0x4a, 0xfc, 0xbf,
+	0x0e, 0x34, 0x17, 0xd1, 0x2e, 0x04, 0xe6, 0x6f, 0x14, 0x82, 0x77, 0x36, 0x3d, 0x4f, 0x07, 0xff,
+	0xa9, 0x53, 0x7c, 0x98, 0xa4, 0x03, 0x07, 0x01, 0x04, 0x87, 0xf1, 0x49, 0x9c, 0xc6, 0x83, 0x0e,
+	0xea, 0x82, 0x4f, 0xe2, 0xfd, 0x83, 0x74, 0xe0, 0x46, 0xbf, 0x1c, 0x08, 0xcf, 0x38, 0x15, 0xb4,
+	0x9c, 0xd1, 0x7f, 0xf1, 0x08, 0x8d, 0xc1, 0x17, 0x32, 0x93, 0x54, 0x5b, 0xd2, 0xdf, 0xc1, 0x4d,
+	0x53, 0xea, 0xb4, 0xe3, 0x73, 0x15, 0x27, 0x86, 0x66, 0x75, 0x79, 0x2d, 0x5d, 0x2f, 0xc0, 0x57,
+	0xf9, 0x04, 0xf6, 0x87, 0xee, 0xa8, 0x4b, 0x0c, 0x88, 0xf6, 0xc0, 0xd7, 0x2f, 0x55, 0xe9, 0xd3,
+	0xc9, 0x49, 0x32, 0x89, 0x8d, 0xa0, 0x2f, 0xd3, 0x64, 0x32, 0x70, 0xb4, 0xc8, 0x7d, 0x92, 0x0e,
+	0x3a, 0xa8, 0x07, 0x1b, 0xd3, 0xa3, 0x23, 0x4d, 0x70, 0xa3, 0xdf, 0x0e, 0x3c, 0x3b, 0xa7, 0x19,
+	0x9f, 0x2d, 0x09, 0xbd, 0xbe, 0xa1, 0x42, 0x9a, 0xae, 0xe9, 0xa3, 0x15, 0xd6, 0x5c, 0xa8, 0xbf,
+	0xaf, 0x6f, 0x28, 0xbf, 0xad, 0x84, 0x19, 0xb0, 0xa6, 0xd8, 0xbd, 0xc7, 0x99, 0xb6, 0x82, 0x2d,
+	0x08, 0xe7, 0x9c, 0x15, 0x69, 0x33, 0x67, 0x16, 0xab, 0xae, 0x4a, 0xa6, 0x23, 0x81, 0xe9, 0xaa,
+	0x64, 0xf5, 0x3d, 0x9b, 0xcf, 0x05, 0x95, 0x7a, 0xd0, 0x7c, 0x52, 0x21, 0x55, 0xd1, 0x55, 0x5e,
+	0xe4, 0x52, 0x8f, 0x99, 0x4f, 0x0c, 0x88, 0x7e, 0x3a, 0xd0, 0x35, 0xba, 0x8e, 0x73, 0x89, 0xde,
+	0x35, 0xf3, 0xab, 0x14, 0xf5, 0x76, 0x5e, 0xde, 0x39, 0x8c, 0xcd, 0x58, 0xbf, 0x85, 0xe0, 0x82,
+	0xce, 0x19, 0x57, 0x06, 0xba, 0xf7, 0xf3, 0x2b, 0x12, 0x7a, 0x03, 0x7e, 0x36, 0x97, 0x94, 0x63,
+	0xf7, 0x21, 0xb6, 0xe1, 0x44, 0xdf, 0x1d, 0xe8, 0xd7, 0x2d, 0x17, 0x2b, 0x56, 0x0a, 0xfa, 0x48,
+	0xcf, 0x5f, 0x83, 0xb7, 0xcc, 0xa5, 0xa8, 0x4a, 0xd9, 0x6c, 0x92, 0x5b, 0x81, 0x44, 0x13, 0x54,
+	0x2b, 0x24, 0x93, 0xd9, 0x95, 0xf6, 0xc0, 0x27, 0x06, 0xb4, 0x1a, 0xe7, 0xb5, 0x1b, 0x17, 0x49,
+	0xe8, 0x1f, 0xe7, 0x42, 0x32, 0x7e, 0xfb, 0x34, 0xeb, 0x6b, 0x23, 0x3b, 0xeb, 0x46, 0x9a, 0x16,
+	0xd8, 0x25, 0x63, 0x71, 0x63, 0x8c, 0xd7, 0x36, 0xe6, 0x87, 0x03, 0xcf, 0xed, 0xb7, 0x4f, 0x92,
+	0x7f, 0xd7, 0xbf, 0x1f, 0x20, 0xac, 0xac, 0x12, 0x0f, 0xf7, 0xdc, 0xd2, 0xd4, 0xa6, 0x5a, 0x66,
+	0xe2, 0x54, 0x79, 0xaa, 0x0a, 0x0a, 0x49, 0x0d, 0xa3, 0x8f, 0xe0, 0x9d, 0xe5, 0xe5, 0xe2, 0xf1,
+	0x32, 0xf4, 0x5e, 0xec, 0x34, 0x7b, 0xf1, 0x33, 0x7c, 0xb3, 0x9b, 0xfb, 0x22, 0xd0, 0xab, 0x7c,
+	0xf7, 0xef, 0x00, 0x61, 0x64, 0x54, 0x6a, 0xe1, 0x05, 0x00, 0x00,
 }
@@ -0,0 +1,134 @@
+package nan0chat
+
+import (
+	"bytes"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Handles a mouse action. The wheel scrolls the box under the pointer. A click on a tab shows it, a click in the
+// output box or a pane gives it the keys and selects the message clicked, and a click in the edit box moves its
+// cursor there.
+func (chatUi *ChatClientUI) handleMouse(ev termbox.Event) {
+	box, line := chatUi.boxAt(ev.MouseX, ev.MouseY)
+	switch ev.Key {
+	case termbox.MouseWheelUp:
+		if box == nil {
+			box = chatUi.activeOutputBox()
+		}
+		chatUi.scrollBoxUp(box, mouse_wheel_lines)
+		return
+	case termbox.MouseWheelDown:
+		if box == nil {
+			box = chatUi.activeOutputBox()
+		}
+		box.scrollDown(mouse_wheel_lines)
+		return
+	case termbox.MouseLeft:
+		// dragging reports the button held down too
+		if ev.Mod&termbox.ModMotion != 0 {
+			return
+		}
+	default:
+		return
+	}
+	// prompts and errors keep the keys until they are done with
+	if chatUi.failure != nil || chatUi.searchBox != nil || chatUi.historySearch != nil {
+		return
+	}
+	chatUi.details = nil
+	l := chatUi.layout
+	switch {
+	case ev.MouseY == l.tabBarY:
+		if tab := chatUi.tabAt(ev.MouseX); tab >= 0 {
+			chatUi.stopSelectingIfSelecting()
+			chatUi.switchTab(tab)
+		}
+	case box != nil:
+		chatUi.focusBox(box)
+		if line >= 0 {
+			chatUi.selectLine(box, line)
+		}
+	case ev.MouseY >= l.editY && ev.MouseY < l.editY+l.editHeight &&
+		ev.MouseX >= l.editX && ev.MouseX < l.editX+l.editWidth:
+		chatUi.stopSelectingIfSelecting()
+		chatUi.editBox.MoveCursorToCell(ev.MouseY-l.editY, ev.MouseX-l.editX)
+		if chatUi.vi != nil {
+			chatUi.viClamp()
+		}
+	}
+}
+
+// Returns the output box or pane shown at the cell and the index of its line there, -1 for a cell without a
+// line. Returns nil outside of them.
+func (chatUi *ChatClientUI) boxAt(x, y int) (*OutputBox, int) {
+	l := chatUi.layout
+	if y < l.outputY || y >= l.outputY+l.outputHeight {
+		return nil, -1
+	}
+	pane := chatUi.sidePane()
+	var box *OutputBox
+	switch {
+	case x >= l.outputX && x < l.outputX+l.outputWidth:
+		box = chatUi.outputBox
+		if pane != nil && l.sideWidth == 0 {
+			box = pane
+		}
+	case pane != nil && l.sideWidth > 0 && x >= l.sideX && x < l.sideX+l.sideWidth:
+		box = pane
+	default:
+		return nil, -1
+	}
+	// the lines are drawn from the second row of the box, see draw
+	line := box.windowTopIndex + y - l.outputY - 1
+	if y == l.outputY || line >= box.windowBottomIndex || line >= len(box.lines) {
+		return box, -1
+	}
+	return box, line
+}
+
+// Gives the keys to the output box or the pane shown next to it
+func (chatUi *ChatClientUI) focusBox(box *OutputBox) {
+	if box == chatUi.activeOutputBox() {
+		return
+	}
+	chatUi.stopSelectingIfSelecting()
+	if box == chatUi.outputBox {
+		chatUi.unfocusedPane = chatUi.sidePane()
+	} else {
+		chatUi.unfocusedPane = nil
+	}
+}
+
+// Selects the message shown on the line of the box, which takes the keys
+func (chatUi *ChatClientUI) selectLine(box *OutputBox, line int) {
+	entry := box.lines[line].message
+	for i, message := range box.messages {
+		if message == entry {
+			chatUi.selecting = true
+			box.selected = i
+			return
+		}
+	}
+}
+
+// Ends selecting messages, if selecting
+func (chatUi *ChatClientUI) stopSelectingIfSelecting() {
+	if chatUi.selecting {
+		chatUi.stopSelecting()
+	}
+}
+
+// Moves the cursor to the character drawn at the cell of the box, given by its row and column, or to the end of
+// the line when the line ends before the column. Like CursorX it depends on the last Draw().
+func (eb *EditBox) MoveCursorToCell(row, col int) {
+	lines := bytes.Split(eb.text, []byte{'\n'})
+	line := minInt(eb.top_line+row, len(lines)-1)
+	start := 0
+	for _, text := range lines[:line] {
+		start += len(text) + 1
+	}
+	eb.MoveCursorTo(start)
+	eb.moveCursorToColumn(col + eb.line_voffset)
+	eb.preferred_col = -1
+}
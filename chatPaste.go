@@ -0,0 +1,99 @@
+package nan0chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// pasted text with more lines or bytes than these is only sent once the user confirms it
+const (
+	large_paste_lines = 20
+	large_paste_bytes = 4096
+)
+
+// most bytes taken in by a single paste, what is pasted beyond it is left out
+const max_paste_bytes = 1 << 20
+
+// Adds the key to the text being pasted. Terminals paste line breaks as Enter, which is a carriage return.
+func addPastedKey(pasted *strings.Builder, ev termbox.Event) {
+	switch {
+	case ev.Key == termbox.KeyEnter:
+		pasted.WriteByte('\r')
+	case ev.Key == termbox.KeyCtrlJ:
+		pasted.WriteByte('\n')
+	case ev.Key == termbox.KeyTab:
+		pasted.WriteByte('\t')
+	case ev.Key == termbox.KeySpace:
+		pasted.WriteByte(' ')
+	case ev.Ch != 0:
+		pasted.WriteRune(ev.Ch)
+	}
+}
+
+// Inserts the text pasted, if a paste is in progress, and handles the keys that follow as typed. The keys after a
+// paste that stalled may still be part of it, so the message it went into is only sent once the user confirms it.
+func (chatUi *ChatClientUI) endPaste(stalled bool) {
+	if chatUi.pasted == nil {
+		return
+	}
+	inMessage := chatUi.paste(chatUi.pasted.String())
+	chatUi.pasted = nil
+	switch {
+	case stalled && inMessage:
+		chatUi.stalledPaste = true
+		chatUi.notice = fmt.Sprintf("The paste didn't end, what arrived of it is sent once %v is pressed twice",
+			chatUi.keysOf("submit"))
+	case chatUi.pasteTruncated:
+		chatUi.notice = fmt.Sprintf("Only the first %v KB of the paste were kept", max_paste_bytes/1024)
+	}
+	// the edit box grows with the lines pasted
+	if chatUi.editBox.Height() != chatUi.layout.editHeight {
+		chatUi.relayout()
+	}
+}
+
+// Inserts the text pasted into the terminal into the message at once, line breaks included, or into the query
+// being typed as a single line. Returns true when the text went into the message.
+func (chatUi *ChatClientUI) paste(text string) bool {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	chatUi.notice = ""
+	switch {
+	case chatUi.failure != nil || chatUi.selecting:
+		// nothing takes text
+		return false
+	case chatUi.searchBox != nil || chatUi.historySearch != nil:
+		for _, r := range strings.Join(strings.Fields(text), " ") {
+			if r == ' ' {
+				chatUi.handleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeySpace})
+			} else {
+				chatUi.handleKey(termbox.Event{Type: termbox.EventKey, Ch: r})
+			}
+		}
+		return false
+	default:
+		chatUi.details = nil
+		chatUi.editBox.InsertString(text)
+		if chatUi.vi != nil {
+			chatUi.viClamp()
+		}
+		chatUi.largePaste = chatUi.largePaste || isLargePaste(text)
+		return true
+	}
+}
+
+// Returns true for text too long to send without asking first
+func isLargePaste(text string) bool {
+	return strings.Count(text, "\n") >= large_paste_lines || len(text) > large_paste_bytes
+}
+
+// Returns the question asked before sending a large paste
+func (chatUi *ChatClientUI) largePastePrompt() string {
+	text := string(chatUi.editBox.text)
+	if chatUi.stalledPaste {
+		return fmt.Sprintf("Send the paste that didn't end? Press %v again to send", chatUi.keysOf("submit"))
+	}
+	return fmt.Sprintf("Send %v lines (%v bytes) pasted? Press %v again to send", strings.Count(text, "\n")+1,
+		len(text), chatUi.keysOf("submit"))
+}
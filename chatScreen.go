@@ -0,0 +1,264 @@
+package nan0chat
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// The surface the ui is drawn on and the source of its input events. Cells are drawn into a back buffer that
+// Flush shows all at once.
+type Screen interface {
+	Init() error
+	Close()
+	Size() (width, height int)
+	Clear(fg, bg termbox.Attribute)
+	SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+	SetCursor(x, y int)
+	Flush() error
+	// waits for the next key press, mouse action or resize
+	PollEvent() termbox.Event
+	// hands the terminal over to run, such as an editor, and takes it back when run returns
+	Suspend(run func() error) error
+	// writes an escape sequence to the terminal itself, such as one setting its title or clipboard or ringing its
+	// bell, apart from the cells
+	WriteRaw(sequence string) error
+}
+
+// The screen of the terminal the client runs in
+type TermboxScreen struct {
+	// the terminal termbox draws on, escape sequences go there too instead of to the standard output, which may
+	// be redirected
+	tty *os.File
+}
+
+func (screen *TermboxScreen) Init() error {
+	if err := termbox.Init(); err != nil {
+		return err
+	}
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		// there is no /dev/tty on Windows, where termbox draws on the console of the standard output
+		tty = os.Stdout
+	}
+	screen.tty = tty
+	// pasted text is told apart from typing, see markPastes
+	return screen.WriteRaw("\x1b[?2004h")
+}
+
+func (screen *TermboxScreen) Close() {
+	screen.WriteRaw("\x1b[?2004l")
+	if screen.tty != os.Stdout {
+		screen.tty.Close()
+	}
+	screen.tty = nil
+	termbox.Close()
+}
+
+func (screen *TermboxScreen) WriteRaw(sequence string) error {
+	if screen.tty == nil {
+		return errors.New("the screen isn't initialized")
+	}
+	_, err := screen.tty.WriteString(sequence)
+	return err
+}
+
+func (*TermboxScreen) Size() (width, height int) {
+	return termbox.Size()
+}
+
+func (*TermboxScreen) Clear(fg, bg termbox.Attribute) {
+	termbox.Clear(fg, bg)
+}
+
+func (*TermboxScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (*TermboxScreen) SetCursor(x, y int) {
+	termbox.SetCursor(x, y)
+}
+
+func (*TermboxScreen) Flush() error {
+	return termbox.Flush()
+}
+
+func (*TermboxScreen) PollEvent() termbox.Event {
+	return termbox.PollEvent()
+}
+
+// Restores the terminal for run and sets it up again afterwards, events polled meanwhile wait for the new setup
+func (screen *TermboxScreen) Suspend(run func() error) error {
+	screen.Close()
+	err := run()
+	if initErr := screen.Init(); initErr != nil {
+		return initErr
+	}
+	return err
+}
+
+// A screen kept in memory, for tests of the ui and for running it without a terminal. Events are injected
+// instead of typed, and what the last Flush showed can be read back cell by cell or as text.
+type MemoryScreen struct {
+	// guards the buffers, which tests read from another goroutine than the one drawing the ui
+	mutex         sync.Mutex
+	width, height int
+	back, front   []termbox.Cell
+	cursorX       int
+	cursorY       int
+	events        chan termbox.Event
+	// the escape sequences written to the terminal, one after the other
+	raw strings.Builder
+}
+
+// Creates an empty screen of the given size
+func NewMemoryScreen(width, height int) *MemoryScreen {
+	screen := &MemoryScreen{events: make(chan termbox.Event, 64)}
+	screen.resizeBuffers(width, height)
+	return screen
+}
+
+func (screen *MemoryScreen) resizeBuffers(width, height int) {
+	screen.width, screen.height = width, height
+	screen.back = make([]termbox.Cell, width*height)
+	screen.front = make([]termbox.Cell, width*height)
+	for i := range screen.back {
+		screen.back[i].Ch = ' '
+		screen.front[i].Ch = ' '
+	}
+}
+
+func (screen *MemoryScreen) Init() error {
+	return nil
+}
+
+func (screen *MemoryScreen) Close() {}
+
+func (screen *MemoryScreen) Suspend(run func() error) error {
+	return run()
+}
+
+func (screen *MemoryScreen) WriteRaw(sequence string) error {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	screen.raw.WriteString(sequence)
+	return nil
+}
+
+func (screen *MemoryScreen) Size() (width, height int) {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	return screen.width, screen.height
+}
+
+func (screen *MemoryScreen) Clear(fg, bg termbox.Attribute) {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	for i := range screen.back {
+		screen.back[i] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+}
+
+// Sets a cell of the back buffer, cells outside the screen are ignored like termbox does
+func (screen *MemoryScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	if x < 0 || x >= screen.width || y < 0 || y >= screen.height {
+		return
+	}
+	screen.back[y*screen.width+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+func (screen *MemoryScreen) SetCursor(x, y int) {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	screen.cursorX, screen.cursorY = x, y
+}
+
+func (screen *MemoryScreen) Flush() error {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	copy(screen.front, screen.back)
+	return nil
+}
+
+func (screen *MemoryScreen) PollEvent() termbox.Event {
+	return <-screen.events
+}
+
+// Queues an event for the ui
+func (screen *MemoryScreen) InjectEvent(ev termbox.Event) {
+	screen.events <- ev
+}
+
+// Queues a press of a special key, such as termbox.KeyEnter
+func (screen *MemoryScreen) InjectKey(key termbox.Key) {
+	screen.InjectEvent(termbox.Event{Type: termbox.EventKey, Key: key})
+}
+
+// Queues a key press for every rune of the text, spaces are sent as termbox.KeySpace like termbox does
+func (screen *MemoryScreen) InjectText(text string) {
+	for _, r := range text {
+		if r == ' ' {
+			screen.InjectKey(termbox.KeySpace)
+			continue
+		}
+		screen.InjectEvent(termbox.Event{Type: termbox.EventKey, Ch: r})
+	}
+}
+
+// Changes the size of the screen and queues the resize event the ui lays itself out again on
+func (screen *MemoryScreen) Resize(width, height int) {
+	screen.mutex.Lock()
+	screen.resizeBuffers(width, height)
+	screen.mutex.Unlock()
+	screen.InjectEvent(termbox.Event{Type: termbox.EventResize, Width: width, Height: height})
+}
+
+// Returns the cell shown at the given location by the last Flush
+func (screen *MemoryScreen) Cell(x, y int) termbox.Cell {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	if x < 0 || x >= screen.width || y < 0 || y >= screen.height {
+		return termbox.Cell{}
+	}
+	return screen.front[y*screen.width+x]
+}
+
+// Returns the location of the cursor
+func (screen *MemoryScreen) Cursor() (x, y int) {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	return screen.cursorX, screen.cursorY
+}
+
+// Returns the escape sequences written to the terminal so far, in the order they were written
+func (screen *MemoryScreen) Raw() string {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	return screen.raw.String()
+}
+
+// Returns the text shown by the last Flush, one line per row with trailing spaces removed, suitable for
+// comparing against a snapshot
+func (screen *MemoryScreen) String() string {
+	screen.mutex.Lock()
+	defer screen.mutex.Unlock()
+	rows := make([]string, screen.height)
+	for y := range rows {
+		var row []rune
+		for x := 0; x < screen.width; x++ {
+			cell := screen.front[y*screen.width+x]
+			row = append(row, cell.Ch)
+			// a wide rune covers the cell after it
+			x += maxInt(runewidth.RuneWidth(cell.Ch), 1) - 1
+		}
+		rows[y] = strings.TrimRight(string(row), " ")
+	}
+	return strings.Join(rows, "\n")
+}
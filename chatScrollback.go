@@ -0,0 +1,98 @@
+package nan0chat
+
+// number of messages requested from the server each time the scrollback reaches past its first message
+const history_page_size = 50
+
+// Scrolls the box up, asking the server for older messages when the scroll reaches past the first message held
+func (chatUi *ChatClientUI) scrollBoxUp(box *OutputBox, lines int) {
+	if lines > box.windowTopIndex && box == chatUi.outputBox {
+		chatUi.loadOlderHistory()
+	}
+	box.scrollUp(lines)
+}
+
+// Requests the page of history sent before the first message held in the output box, unless a page is on its
+// way already or the whole history of the room shown has been loaded
+func (chatUi *ChatClientUI) loadOlderHistory() {
+	box := chatUi.outputBox
+	if box.historyRequest != nil || box.historyComplete {
+		return
+	}
+	request := &HistoryRequest{
+		RequestId: random.Int63(),
+		Room:      chatUi.tab().room,
+		Limit:     history_page_size,
+	}
+	if len(box.messages) > 0 {
+		request.BeforeId = box.messages[0].MessageId
+	}
+	box.historyRequest = request
+	chatUi.messageChannel <- request
+}
+
+// Adds a page of older history above the messages held in the output box of the room's tab
+func (chatUi *ChatClientUI) receiveHistory(response *HistoryResponse) {
+	tab := chatUi.findTab(response.Room, "")
+	if tab == nil {
+		return
+	}
+	box := tab.box
+	if box.historyRequest == nil || response.RequestId != box.historyRequest.RequestId {
+		return
+	}
+	box.historyRequest = nil
+	box.historyComplete = !response.HasMore
+
+	var entries []*chatEntry
+	for _, message := range response.Messages {
+		// the page may overlap messages that arrived while it was requested
+		if box.findMessage(message.MessageId) == nil {
+			entries = append(entries, &chatEntry{ChatMessage: message, alert: chatUi.alerts(message)})
+		}
+	}
+	box.prependMessages(entries)
+}
+
+// Adds older messages before the messages held, keeping the lines in the drawing window where they are
+func (outputBox *OutputBox) prependMessages(entries []*chatEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	lineCount := len(outputBox.lines)
+	outputBox.messages = append(entries, outputBox.messages...)
+	outputBox.rebuildLines()
+
+	added := len(outputBox.lines) - lineCount
+	outputBox.windowTopIndex += added
+	outputBox.windowBottomIndex += added
+	// a window that wasn't full yet fills up with the older lines
+	for outputBox.windowBottomIndex > len(outputBox.lines) && outputBox.windowTopIndex > 0 {
+		outputBox.windowUp()
+	}
+
+	// indices of messages held moved down by the number of messages added
+	if outputBox.selected >= 0 {
+		outputBox.selected += len(entries)
+	}
+	if outputBox.search != nil {
+		for i := range outputBox.search.hits {
+			outputBox.search.hits[i] += len(entries)
+		}
+		// so do the lines of the window a cancelled search goes back to
+		outputBox.search.windowTopIndex += added
+		outputBox.search.windowBottomIndex += added
+	}
+}
+
+// Returns the text shown on the top border of the output box while the first message held is in view
+func (outputBox *OutputBox) historyIndicator() string {
+	switch {
+	case outputBox.windowTopIndex > 0:
+		return ""
+	case outputBox.historyRequest != nil:
+		return " Loading earlier messages… "
+	case outputBox.historyComplete:
+		return " Beginning of the history "
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package nan0chat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// State of an incremental search over the messages held in an output box
+type scrollbackSearch struct {
+	query string
+	// true when the query is a regular expression, otherwise it is a case-insensitive substring
+	regex   bool
+	pattern *regexp.Regexp
+	err     error
+	// indices of the messages matching the query, oldest first
+	hits []int
+	// index in hits of the message the window was scrolled to, -1 when nothing matches
+	current int
+	// drawing window before the search started, restored when it is cancelled
+	windowTopIndex, windowBottomIndex int
+}
+
+// Starts searching the messages of the visible output box for the given query
+func (chatUi *ChatClientUI) startSearch(query string) {
+	box := chatUi.activeOutputBox()
+	chatUi.searchBox = box
+	box.search = &scrollbackSearch{
+		query:             query,
+		current:           -1,
+		windowTopIndex:    box.windowTopIndex,
+		windowBottomIndex: box.windowBottomIndex,
+	}
+	box.updateSearch()
+}
+
+// Ends the search, leaving the window where the search scrolled it unless the search is cancelled
+func (chatUi *ChatClientUI) stopSearch(cancel bool) {
+	box := chatUi.searchBox
+	if cancel && box.search != nil {
+		box.windowTopIndex = box.search.windowTopIndex
+		box.windowBottomIndex = box.search.windowBottomIndex
+	}
+	box.search = nil
+	chatUi.searchBox = nil
+}
+
+// Handles a key press while the search prompt is shown. The keys bound to escape or cancel cancel the search,
+// submit ends it, up, history-previous and search go to an older match, down and history-next to a newer one,
+// complete switches the mode and delete-backward deletes from the query. Other keys type into the query.
+func (chatUi *ChatClientUI) handleSearchKey(ev termbox.Event) {
+	box := chatUi.searchBox
+	search := box.search
+	switch chatUi.boundAction(ev) {
+	case "escape", "cancel":
+		chatUi.stopSearch(true)
+	case "submit":
+		chatUi.stopSearch(false)
+	case "up", "history-previous", "search":
+		box.stepSearch(-1)
+	case "down", "history-next":
+		box.stepSearch(1)
+	case "complete":
+		search.regex = !search.regex
+		box.updateSearch()
+	case "delete-backward":
+		if search.query != "" {
+			runes := []rune(search.query)
+			search.query = string(runes[:len(runes)-1])
+			box.updateSearch()
+		}
+	default:
+		switch {
+		case ev.Key == termbox.KeySpace:
+			search.query += " "
+			box.updateSearch()
+		case ev.Ch != 0:
+			search.query += string(ev.Ch)
+			box.updateSearch()
+		}
+	}
+}
+
+// Returns the search prompt shown below the edit box and the cell the cursor is placed at inside it
+func (chatUi *ChatClientUI) searchPrompt() (prompt string, cursor int) {
+	search := chatUi.searchBox.search
+	mode := "text"
+	if search.regex {
+		mode = "regex"
+	}
+	prompt = fmt.Sprintf("Search %v: %v", mode, search.query)
+	cursor = runewidth.StringWidth(prompt)
+	switch {
+	case search.err != nil:
+		prompt += "  (invalid pattern)"
+	case search.query != "" && len(search.hits) == 0:
+		prompt += "  (no matches)"
+	case len(search.hits) > 0:
+		prompt += fmt.Sprintf("  (%v/%v)", search.current+1, len(search.hits))
+	}
+	hints := chatUi.keyHints(keyHint{"up", "older"}, keyHint{"down", "newer"}, keyHint{"complete", "mode"},
+		keyHint{"submit", "done"}, keyHint{"escape", "cancel"})
+	return prompt + "  " + strings.Join(hints, ", "), cursor
+}
+
+// Compiles the query and finds every matching message, scrolling to the latest match
+func (outputBox *OutputBox) updateSearch() {
+	search := outputBox.search
+	search.pattern, search.err, search.hits, search.current = nil, nil, nil, -1
+	if search.query == "" {
+		return
+	}
+	expr := search.query
+	if !search.regex {
+		expr = "(?i)" + regexp.QuoteMeta(expr)
+	}
+	search.pattern, search.err = regexp.Compile(expr)
+	if search.err != nil {
+		return
+	}
+	for i, entry := range outputBox.messages {
+		if search.pattern.MatchString(entry.displayText()) {
+			search.hits = append(search.hits, i)
+		}
+	}
+	if len(search.hits) > 0 {
+		search.current = len(search.hits) - 1
+		outputBox.scrollToHit()
+	}
+}
+
+// Moves to an older (negative) or newer (positive) match
+func (outputBox *OutputBox) stepSearch(direction int) {
+	search := outputBox.search
+	next := search.current + direction
+	if next < 0 || next >= len(search.hits) {
+		return
+	}
+	search.current = next
+	outputBox.scrollToHit()
+}
+
+// Shifts the drawing window to the line holding the current match
+func (outputBox *OutputBox) scrollToHit() {
+	search := outputBox.search
+	index := search.hits[search.current]
+	entry := outputBox.messages[index]
+	for i, line := range outputBox.lines {
+		if line.message == entry && search.pattern.MatchString(line.text) {
+			for i < outputBox.windowTopIndex {
+				outputBox.windowUp()
+			}
+			for i >= outputBox.windowBottomIndex && outputBox.windowBottomIndex < len(outputBox.lines) {
+				outputBox.windowDown()
+			}
+			return
+		}
+	}
+	// the match spans a line break, show the whole message instead
+	outputBox.scrollToMessage(index)
+}
+
+// Returns the byte ranges of the line matching the search, nil when no search is active
+func (outputBox *OutputBox) searchMatches(line outputLine) [][]int {
+	if outputBox.search == nil || outputBox.search.pattern == nil {
+		return nil
+	}
+	return outputBox.search.pattern.FindAllStringIndex(line.text, -1)
+}
+
+// Returns true when the line belongs to the message of the current match
+func (outputBox *OutputBox) isCurrentHit(line outputLine) bool {
+	search := outputBox.search
+	if search == nil || search.current < 0 || line.message == nil {
+		return false
+	}
+	return outputBox.messages[search.hits[search.current]] == line.message
+}
+
+// Prints the message like tbprint, drawing the given byte ranges in reverse video
+func tbprinthighlighted(screen Screen, x, y int, fg, bg termbox.Attribute, msg string, ranges [][]int, highlight termbox.Attribute) {
+	for i, c := range msg {
+		cfg := fg
+		for _, r := range ranges {
+			if i >= r[0] && i < r[1] {
+				cfg = fg | highlight
+			}
+		}
+		screen.SetCell(x, y, c, cfg, bg)
+		x += runewidth.RuneWidth(c)
+	}
+}
@@ -0,0 +1,292 @@
+package nan0chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// An action that can be taken on the message selected in the output box
+type selectionAction struct {
+	key  rune
+	name string
+	run  func(chatUi *ChatClientUI, entry *chatEntry)
+	// whether the action works on the message as held by the tab of its room or conversation, which is shown
+	inTab bool
+}
+
+// The actions available in selection mode, in the order they are listed in the hint line
+var selectionActions = []selectionAction{
+	{'r', "reply", (*ChatClientUI).replyToEntry, true},
+	{'t', "thread", (*ChatClientUI).openThread, true},
+	{'c', "copy", (*ChatClientUI).copyEntry, false},
+	{'+', "react", (*ChatClientUI).startReacting, true},
+	{'e', "edit", (*ChatClientUI).startEditing, true},
+	{'d', "delete", (*ChatClientUI).deleteEntry, true},
+	{'i', "details", (*ChatClientUI).showDetails, false},
+	{'g', "go to result", (*ChatClientUI).jumpToEntry, false},
+}
+
+// Handles a key press while the highlight cursor is moving over the messages of the output box. The keys of the
+// escape, cancel, up, down and submit actions work as bound, the letters of the selection actions are fixed.
+func (chatUi *ChatClientUI) handleSelectionKey(ev termbox.Event) {
+	box := chatUi.activeOutputBox()
+	action := chatUi.boundAction(ev)
+	switch {
+	case action == "escape" || action == "cancel":
+		chatUi.stopSelecting()
+		return
+	case action == "up" || ev.Ch == 'k':
+		box.selectPrevious()
+		return
+	case action == "down" || ev.Ch == 'j':
+		box.selectNext()
+		return
+	case action == "submit" && box == chatUi.searchResults:
+		// submitting jumps to search results and replies to other messages
+		ev.Ch = 'g'
+	case action == "submit":
+		ev.Ch = 'r'
+	}
+
+	entry := box.selectedMessage()
+	if entry == nil {
+		return
+	}
+	for _, action := range selectionActions {
+		if action.key != ev.Ch {
+			continue
+		}
+		chatUi.stopSelecting()
+		if action.inTab {
+			if entry = chatUi.showInTab(box, entry); entry == nil {
+				chatUi.notice = fmt.Sprintf("Can't %v from here, the message isn't loaded in its tab", action.name)
+				return
+			}
+		}
+		action.run(chatUi, entry)
+		return
+	}
+}
+
+// Returns the message selected in the box as held by the tab of its room or conversation, and shows that tab.
+// Search results and their context hold copies of messages of any room, these are looked up in their tab, which
+// returns nil when it doesn't hold the message.
+func (chatUi *ChatClientUI) showInTab(box *OutputBox, entry *chatEntry) *chatEntry {
+	if box == chatUi.outputBox || box == chatUi.thread {
+		return entry
+	}
+	if entry.MessageId == 0 {
+		return nil
+	}
+	tab := chatUi.tabOf(entry.ChatMessage, false)
+	if tab == nil {
+		return nil
+	}
+	local := tab.box.findMessage(entry.MessageId)
+	if local == nil {
+		return nil
+	}
+	chatUi.results = nil
+	chatUi.switchTab(chatUi.tabIndex(tab))
+	return local
+}
+
+// Places the highlight cursor on the latest message of the visible output box
+func (chatUi *ChatClientUI) startSelecting() {
+	box := chatUi.activeOutputBox()
+	if len(box.messages) == 0 {
+		return
+	}
+	chatUi.selecting = true
+	box.selected = len(box.messages) - 1
+	box.scrollToMessage(box.selected)
+}
+
+// Removes the highlight cursor and returns keys to the edit box
+func (chatUi *ChatClientUI) stopSelecting() {
+	chatUi.selecting = false
+	chatUi.activeOutputBox().selected = -1
+}
+
+// Returns the line shown below the edit box describing what the user is currently doing
+func (chatUi *ChatClientUI) hint() string {
+	switch {
+	case chatUi.notice != "":
+		return chatUi.notice
+	case (chatUi.largePaste || chatUi.stalledPaste) && chatUi.lastAction == "submit":
+		return chatUi.largePastePrompt()
+	case chatUi.selecting:
+		keys := chatUi.keyHints(keyHint{"up", "up"}, keyHint{"down", "down"})
+		for _, action := range selectionActions {
+			keys = append(keys, fmt.Sprintf("%c %v", action.key, action.name))
+		}
+		keys = append(keys, chatUi.keyHints(keyHint{"escape", "cancel"})...)
+		return strings.Join(keys, ", ")
+	case chatUi.editing != nil:
+		return "Editing your message" + chatUi.keyHintsInParentheses(keyHint{"cancel", "to cancel"})
+	case chatUi.reacting != nil:
+		return "Type a reaction to " + excerpt(chatUi.reacting.displayText()) +
+			chatUi.keyHintsInParentheses(keyHint{"cancel", "to cancel"})
+	case chatUi.replyTo != nil:
+		return "Replying to " + excerpt(chatUi.replyTo.displayText()) +
+			chatUi.keyHintsInParentheses(keyHint{"cancel", "to cancel"})
+	}
+	return ""
+}
+
+// Makes the next sent message a reply to the given message
+func (chatUi *ChatClientUI) replyToEntry(entry *chatEntry) {
+	chatUi.cancelPending()
+	chatUi.replyTo = entry
+}
+
+// Expands the thread containing the given message into its own view
+func (chatUi *ChatClientUI) openThread(entry *chatEntry) {
+	root := chatUi.outputBox.threadRootOf(entry)
+	thread := chatUi.newPane(" Thread" + chatUi.keyHintsInParentheses(keyHint{"escape", "to close"}) + " ")
+	thread.threadRoot = root
+	for _, m := range chatUi.outputBox.messages {
+		if chatUi.outputBox.threadRootOf(m) == root {
+			thread.addMessage(m)
+		}
+	}
+	chatUi.results = nil
+	chatUi.thread = thread
+	chatUi.relayout()
+}
+
+// Creates an empty output box to be shown as a pane with the given title
+func (chatUi *ChatClientUI) newPane(title string) *OutputBox {
+	return &OutputBox{
+		width:             chatUi.outputBox.width,
+		height:            chatUi.outputBox.height,
+		windowBottomIndex: chatUi.outputBox.height - 1,
+		selected:          -1,
+		title:             title,
+		highlight:         chatUi.highlight,
+	}
+}
+
+// Copies the text of the message to the system clipboard, it can also be pasted into the edit box with Ctrl-V.
+// The text is copied as sent, without the marks added when it is shown.
+func (chatUi *ChatClientUI) copyEntry(entry *chatEntry) {
+	if entry.deleted {
+		chatUi.notice = "Deleted messages can't be copied"
+		return
+	}
+	chatUi.copyText(entry.Message, "message")
+}
+
+// Copies every message with a line in the drawing window of the visible output box
+func (chatUi *ChatClientUI) copyTranscript(args string) {
+	box := chatUi.activeOutputBox()
+	var messages []string
+	var last *chatEntry
+	for i := box.windowTopIndex; i < box.windowBottomIndex && i < len(box.lines); i++ {
+		if entry := box.lines[i].message; entry != nil && entry != last {
+			messages = append(messages, entry.displayText())
+			last = entry
+		}
+	}
+	if len(messages) == 0 {
+		chatUi.notice = "Nothing to copy"
+		return
+	}
+	chatUi.copyText(strings.Join(messages, "\n"), "transcript")
+}
+
+// Copies the text to the system clipboard and keeps it for pasting with Ctrl-V, telling the user where it went
+func (chatUi *ChatClientUI) copyText(text, what string) {
+	chatUi.clipboard = text
+	file, err := copyToClipboard(chatUi.screen, text)
+	switch {
+	case err != nil:
+		chatUi.notice = fmt.Sprintf("Couldn't copy the %v: %v", what, err)
+	case file != "":
+		chatUi.notice = fmt.Sprintf("Copied the %v to %v", what, file)
+	default:
+		chatUi.notice = fmt.Sprintf("Copied the %v to the clipboard", what)
+	}
+}
+
+// Lets the user type a reaction to the given message in the edit box
+func (chatUi *ChatClientUI) startReacting(entry *chatEntry) {
+	if entry.deleted {
+		chatUi.notice = "Deleted messages can't be reacted to"
+		return
+	}
+	chatUi.cancelPending()
+	chatUi.reacting = entry
+}
+
+// Loads the given message into the edit box so that the user can change it
+func (chatUi *ChatClientUI) startEditing(entry *chatEntry) {
+	if entry.UserId != chatUi.userId || entry.deleted {
+		chatUi.notice = "Only your own messages can be edited"
+		return
+	}
+	chatUi.cancelPending()
+	chatUi.editing = entry
+	chatUi.editBox.SetText(strings.TrimPrefix(entry.Message, chatUi.editBoxPrefix))
+}
+
+// Deletes the given message for every connected user
+func (chatUi *ChatClientUI) deleteEntry(entry *chatEntry) {
+	if entry.UserId != chatUi.userId || entry.deleted {
+		chatUi.notice = "Only your own messages can be deleted"
+		return
+	}
+	chatUi.sendMessage(&ChatMessage{
+		Action:   ChatMessage_DELETE,
+		TargetId: entry.MessageId,
+	})
+}
+
+// Shows the details of the given message over the output box until the next key press
+func (chatUi *ChatClientUI) showDetails(entry *chatEntry) {
+	chatUi.details = entry
+}
+
+// Draws the details of the selected message in a box at the given location
+func (chatUi *ChatClientUI) drawDetails(x, y, w int) {
+	const coldef = termbox.ColorDefault
+	screen := chatUi.screen
+	entry := chatUi.details
+
+	sender := fmt.Sprint(entry.UserId)
+	if entry.UserId == chatUi.userId {
+		sender += " (you)"
+	}
+	replyTo := "-"
+	if entry.ReplyTo != 0 {
+		replyTo = fmt.Sprint(entry.ReplyTo)
+	}
+	reactions := "-"
+	if len(entry.reactions) > 0 {
+		reactions = strings.TrimSpace(entry.reactionText())
+	}
+	lines := []string{
+		"Message details",
+		"",
+		"Id:        " + fmt.Sprint(entry.MessageId),
+		"Sender:    " + sender,
+		"Sent:      " + time.Unix(entry.Time, 0).Format("2006-01-02 15:04:05"),
+		"Reply to:  " + replyTo,
+		"Edited:    " + fmt.Sprint(entry.edited),
+		"Deleted:   " + fmt.Sprint(entry.deleted),
+		"Reactions: " + reactions,
+		"",
+		"Press any key to close",
+	}
+
+	fill(screen, x-1, y-1, w+2, len(lines)+2, termbox.Cell{Ch: ' '})
+	fill(screen, x-1, y-1, w+2, 1, termbox.Cell{Ch: '─'})
+	fill(screen, x-1, y+len(lines), w+2, 1, termbox.Cell{Ch: '─'})
+	for i, line := range lines {
+		tbprint(screen, x, y+i, coldef, coldef, runewidth.Truncate(line, w, "…"))
+	}
+}
@@ -5,15 +5,23 @@ import (
 	"time"
 			"fmt"
 	"github.com/golang/protobuf/proto"
+	"sort"
+	"sync"
 )
 
 type ChatServer struct {
 	users    map[int64]*ConnectedUser
 	internal *nan0.Service
+	history  *chatHistory
+	// guards the names and rooms of the connected users
+	mutex sync.RWMutex
 }
 
 type ConnectedUser struct {
 	conn nan0.NanoServiceWrapper
+	// the name the user announced when coming online and the rooms the user joined
+	name  string
+	rooms map[string]bool
 }
 
 func Serve(port int) (err error) {
@@ -26,18 +34,26 @@ func Serve(port int) (err error) {
 			StartTime:   time.Now().Unix(),
 			ServiceType: "Chat",
 		},
-		users: make(map[int64]*ConnectedUser),
+		users:   make(map[int64]*ConnectedUser),
+		history: newChatHistory(),
 	}
 
 	// build server and start listening for clients
 	server, err := service.internal.NewNanoBuilder().
 		AddMessageIdentity(proto.Clone(new(ChatMessage))).
+		AddMessageIdentity(proto.Clone(new(SearchRequest))).
+		AddMessageIdentity(proto.Clone(new(SearchResponse))).
+		AddMessageIdentity(proto.Clone(new(HistoryRequest))).
+		AddMessageIdentity(proto.Clone(new(HistoryResponse))).
+		AddMessageIdentity(proto.Clone(new(Presence))).
+		AddMessageIdentity(proto.Clone(new(Ping))).
+		AddMessageIdentity(proto.Clone(new(User))).
 		EnableEncryption(KeysToNan0Bytes(*EncryptKey, *Signature)).
 		ToggleWriteDeadline(true).
 	BuildServer(nil)
 
 	if err != nil {
-		return err
+		return &ServeError{Port: port, Err: err}
 	}
 
 	// shutdown server on exit or error
@@ -53,9 +69,12 @@ func Serve(port int) (err error) {
 			// when we get a new connection, create a random user id, save the connection to the map of connected clients
 			conn := <-server.GetConnections()
 			newUserId := random.Int63()
+			service.mutex.Lock()
 			service.users[newUserId] = &ConnectedUser{
-				conn: conn,
+				conn:  conn,
+				rooms: make(map[string]bool),
 			}
+			service.mutex.Unlock()
 
 			fmt.Printf("New user %v connected.\n", newUserId)
 
@@ -72,18 +91,140 @@ func (s *ChatServer) startDistributor(userId int64, conn nan0.NanoServiceWrapper
 	defer conn.Close()
 	receiver := conn.GetReceiver()
 	for ; ; {
-		msg := <-receiver
+		msg, ok := <-receiver
+		// a closed connection takes the user offline
+		if !ok {
+			s.announce(userId, &Presence{State: Presence_OFFLINE})
+			return
+		}
 
-		// if we have some data inside the message
-		if msg != nil {
-			// broadcast the message to all connected clients that are NOT the client that generated the message
+		switch msg := msg.(type) {
+		// chat messages are stored in the history and passed on to the users in their room, direct messages
+		// are passed on to their recipient only and aren't kept
+		case *ChatMessage:
+			s.stampSender(userId, msg)
+			if msg.Recipient == "" {
+				s.history.add(msg)
+			}
 			// we assume that the subject client has kept track of its own message
-			for id, user := range s.users {
-				if id != userId {
-					sender := user.conn.GetSender()
-					sender <- msg
-				}
+			for _, user := range s.recipientsOf(userId, msg) {
+				sender := user.conn.GetSender()
+				sender <- msg
+			}
+		// pings are answered right away so that clients can measure the round trip
+		case *Ping:
+			conn.GetSender() <- msg
+		// users coming online, joining and leaving rooms, and going offline are announced to the users concerned
+		case *Presence:
+			s.announce(userId, msg)
+			// the client learns the id its messages are stamped with, which it needs to tell its own apart
+			if msg.State == Presence_ONLINE {
+				conn.GetSender() <- &User{UserId: userId, UserName: msg.UserName}
+			}
+		// searches of the history are answered to the requesting client only
+		case *SearchRequest:
+			hits, total := s.history.search(msg)
+			conn.GetSender() <- &SearchResponse{
+				RequestId: msg.RequestId,
+				Hits:      hits,
+				Total:     int32(total),
+				Offset:    msg.Offset,
+			}
+		// pages of older history are sent to the requesting client only
+		case *HistoryRequest:
+			messages, hasMore := s.history.before(msg)
+			conn.GetSender() <- &HistoryResponse{
+				RequestId: msg.RequestId,
+				Room:      msg.Room,
+				Messages:  messages,
+				HasMore:   hasMore,
 			}
 		}
 	}
 }
+
+// Stamps the message as sent by the user of the connection it came from, whatever the client filled in. Only the
+// sender of a message may change it, and the ids in the messages are seen by everyone.
+func (s *ChatServer) stampSender(userId int64, msg *ChatMessage) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	msg.UserId = userId
+	if user := s.users[userId]; user != nil {
+		msg.UserName = user.name
+	}
+}
+
+// Returns the users the message is passed on to: the users in its room or the recipient of a direct message,
+// leaving out the user who sent it
+func (s *ChatServer) recipientsOf(userId int64, msg *ChatMessage) (recipients []*ConnectedUser) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for id, user := range s.users {
+		switch {
+		case id == userId:
+		case msg.Recipient != "":
+			if user.name == msg.Recipient {
+				recipients = append(recipients, user)
+			}
+		// messages from clients that don't know about rooms reach everyone
+		case msg.Room == "" || user.rooms[msg.Room]:
+			recipients = append(recipients, user)
+		}
+	}
+	return
+}
+
+// Records the change of presence of the user and passes it on to the users concerned
+func (s *ChatServer) announce(userId int64, presence *Presence) {
+	for _, user := range s.updatePresence(userId, presence) {
+		user.conn.GetSender() <- presence
+	}
+}
+
+// Records the user coming online, joining or leaving a room, or going offline, filling in the users now online
+// or in the room. Returns the users the change is announced to: everyone online for users coming online or going
+// offline, the users in the room (including the user who left it) otherwise. A user going offline is forgotten,
+// the connection is still answered until the client closes it.
+func (s *ChatServer) updatePresence(userId int64, presence *Presence) (recipients []*ConnectedUser) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := s.users[userId]
+	if user == nil {
+		return nil
+	}
+	// like messages, the change is stamped with the user of the connection
+	presence.UserId = userId
+	switch presence.State {
+	case Presence_ONLINE:
+		user.name = presence.UserName
+		for _, other := range s.users {
+			if other.name != "" {
+				presence.Users = append(presence.Users, other.name)
+				recipients = append(recipients, other)
+			}
+		}
+	case Presence_OFFLINE:
+		presence.UserName = user.name
+		delete(s.users, userId)
+		for _, other := range s.users {
+			if other.name != "" {
+				presence.Users = append(presence.Users, other.name)
+				recipients = append(recipients, other)
+			}
+		}
+	case Presence_JOIN, Presence_PART:
+		presence.UserName = user.name
+		if presence.State == Presence_PART {
+			recipients = append(recipients, user)
+		}
+		user.rooms[presence.Room] = presence.State == Presence_JOIN
+		for _, other := range s.users {
+			if other.rooms[presence.Room] {
+				presence.Users = append(presence.Users, other.name)
+				recipients = append(recipients, other)
+			}
+		}
+	}
+	sort.Strings(presence.Users)
+	return
+}
@@ -0,0 +1,34 @@
+package nan0chat
+
+import (
+	"testing"
+)
+
+// A client copying the id of another user into its messages mustn't be able to change the messages of that user
+func TestMessagesAreStampedWithTheSenderOfTheConnection(t *testing.T) {
+	s := &ChatServer{users: make(map[int64]*ConnectedUser), history: newChatHistory()}
+	s.users[1] = &ConnectedUser{name: "alice", rooms: make(map[string]bool)}
+	s.users[2] = &ConnectedUser{name: "mallory", rooms: make(map[string]bool)}
+
+	post := &ChatMessage{MessageId: 10, UserId: 99, UserName: "someone", Message: "hello"}
+	s.stampSender(1, post)
+	s.history.add(post)
+	if post.UserId != 1 || post.UserName != "alice" {
+		t.Fatalf("message stamped %v %q, want the user of the connection, 1 alice", post.UserId, post.UserName)
+	}
+	edit := &ChatMessage{Action: ChatMessage_EDIT, TargetId: 10, UserId: 1, UserName: "alice", Message: "bye"}
+	s.stampSender(2, edit)
+	s.history.add(edit)
+	remove := &ChatMessage{Action: ChatMessage_DELETE, TargetId: 10, UserId: 1, UserName: "alice"}
+	s.stampSender(2, remove)
+	s.history.add(remove)
+	if hits, total := s.history.search(&SearchRequest{Query: "hello"}); total != 1 || hits[0].Message.Message != "hello" {
+		t.Errorf("found %v messages after another user changed it, want the message unchanged", total)
+	}
+
+	presence := &Presence{UserId: 1, UserName: "alice", State: Presence_JOIN, Room: "#random"}
+	s.updatePresence(2, presence)
+	if presence.UserId != 2 || presence.UserName != "mallory" {
+		t.Errorf("presence stamped %v %q, want the user of the connection, 2 mallory", presence.UserId, presence.UserName)
+	}
+}
@@ -0,0 +1,148 @@
+package nan0chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// how often the round trip to the server is measured
+const ping_interval = 5 * time.Second
+
+// a ping left unanswered for this long marks the server as offline
+const ping_timeout = 2 * ping_interval
+
+// The state of the connection to the server
+type connectionState int
+
+const (
+	state_connecting connectionState = iota
+	state_connected
+	state_reconnecting
+	state_offline
+)
+
+func (state connectionState) String() string {
+	switch state {
+	case state_connecting:
+		return "connecting"
+	case state_connected:
+		return "connected"
+	case state_reconnecting:
+		return "reconnecting"
+	}
+	return "offline"
+}
+
+// A piece of information shown on the status bar
+type statusSegment struct {
+	name string
+	text func(chatUi *ChatClientUI) string
+}
+
+// The segments the status bar can show, the -status flag picks among them by name
+var statusSegments = []statusSegment{
+	{"state", (*ChatClientUI).connectionStatus},
+	{"server", func(chatUi *ChatClientUI) string { return chatUi.server }},
+	{"room", func(chatUi *ChatClientUI) string { return chatUi.tab().name() }},
+	{"users", (*ChatClientUI).onlineStatus},
+	{"latency", (*ChatClientUI).latencyStatus},
+	{"clock", func(chatUi *ChatClientUI) string { return time.Now().Format("15:04") }},
+	{"dnd", (*ChatClientUI).doNotDisturbStatus},
+	{"mode", (*ChatClientUI).viModeStatus},
+	{"keys", (*ChatClientUI).keysStatus},
+}
+
+// Returns the segments named in the comma separated list, in its order, leaving out unknown names
+func parseStatusSegments(names string) (segments []statusSegment) {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		for _, segment := range statusSegments {
+			if segment.name == name {
+				segments = append(segments, segment)
+			}
+		}
+	}
+	return
+}
+
+// Returns the state of the connection as shown on the status bar
+func (chatUi *ChatClientUI) connectionStatus() string {
+	symbol := "●"
+	if chatUi.connection != state_connected {
+		symbol = "○"
+	}
+	return symbol + " " + chatUi.connection.String()
+}
+
+// Returns the number of users connected to the server as shown on the status bar
+func (chatUi *ChatClientUI) onlineStatus() string {
+	if len(chatUi.online) == 1 {
+		return "1 user online"
+	}
+	return fmt.Sprintf("%v users online", len(chatUi.online))
+}
+
+// Returns the round trip time last measured as shown on the status bar
+func (chatUi *ChatClientUI) latencyStatus() string {
+	if chatUi.latency == 0 || chatUi.connection != state_connected {
+		return "– ms"
+	}
+	return fmt.Sprintf("%v ms", int64(chatUi.latency/time.Millisecond))
+}
+
+// Sends a ping to the server to measure the round trip, unless the previous ping is unanswered or there is no
+// connection. A ping left unanswered for too long marks the server as offline until it answers.
+func (chatUi *ChatClientUI) sendPing() {
+	if chatUi.connection == state_connecting || chatUi.connection == state_reconnecting || chatUi.failure != nil {
+		return
+	}
+	now := time.Now()
+	if chatUi.ping != nil {
+		if now.Sub(time.Unix(0, chatUi.ping.Time)) >= ping_timeout {
+			chatUi.connection = state_offline
+		}
+		return
+	}
+	chatUi.ping = &Ping{
+		RequestId: random.Int63(),
+		Time:      now.UnixNano(),
+	}
+	chatUi.messageChannel <- chatUi.ping
+}
+
+// Returns a reminder that do not disturb is on, nothing otherwise
+func (chatUi *ChatClientUI) doNotDisturbStatus() string {
+	if chatUi.doNotDisturb {
+		return "do not disturb"
+	}
+	return ""
+}
+
+// Measures the round trip of the ping answered by the server
+func (chatUi *ChatClientUI) receivePing(ping *Ping) {
+	if chatUi.ping == nil || ping.RequestId != chatUi.ping.RequestId {
+		return
+	}
+	chatUi.latency = time.Since(time.Unix(0, ping.Time))
+	chatUi.ping = nil
+	chatUi.connection = state_connected
+}
+
+// Draws the status bar across the whole row, the segments with something to show separated by bars
+func (chatUi *ChatClientUI) drawStatusBar(y int) {
+	const coldef = termbox.ColorDefault
+	screen := chatUi.screen
+	var texts []string
+	for _, segment := range chatUi.statusSegments {
+		if text := segment.text(chatUi); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	status := runewidth.Truncate(" "+strings.Join(texts, " │ "), chatUi.termWidth, "…")
+	fill(screen, 0, y, chatUi.termWidth, 1, termbox.Cell{Ch: ' ', Fg: coldef | termbox.AttrReverse, Bg: coldef})
+	tbprint(screen, 0, y, coldef|termbox.AttrReverse, coldef, status)
+}
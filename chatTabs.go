@@ -0,0 +1,299 @@
+package nan0chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// A room or a direct conversation with another user, each with its own output box and shown as a tab
+type chatTab struct {
+	// the room messages typed in this tab are sent to, empty for a direct conversation
+	room string
+	// the user a direct conversation is held with, empty for a room
+	peer string
+	box  *OutputBox
+	// messages, and messages mentioning the local user or a keyword, received while another tab was shown
+	unread   int
+	mentions int
+	// the users in the room as last announced by the server
+	members []string
+}
+
+// Returns the name of the tab as shown on the tab bar
+func (tab *chatTab) name() string {
+	if tab.peer != "" {
+		return "@" + tab.peer
+	}
+	return "#" + tab.room
+}
+
+// Returns the tab shown in the output box, which messages typed into the edit box are sent to
+func (chatUi *ChatClientUI) tab() *chatTab {
+	return chatUi.tabs[chatUi.activeTab]
+}
+
+// Returns the tab of the room, or of the direct conversation with the peer, or nil if it isn't open
+func (chatUi *ChatClientUI) findTab(room, peer string) *chatTab {
+	for _, tab := range chatUi.tabs {
+		if tab.room == room && tab.peer == peer {
+			return tab
+		}
+	}
+	return nil
+}
+
+// Returns the position of the tab on the tab bar, or -1 if it isn't open
+func (chatUi *ChatClientUI) tabIndex(tab *chatTab) int {
+	for i, t := range chatUi.tabs {
+		if t == tab {
+			return i
+		}
+	}
+	return -1
+}
+
+// Opens a tab for the room, or for the direct conversation with the peer, unless it is open already.
+// The new tab is added to the end of the tab bar without being shown.
+func (chatUi *ChatClientUI) openTab(room, peer string) *chatTab {
+	if tab := chatUi.findTab(room, peer); tab != nil {
+		return tab
+	}
+	tab := &chatTab{
+		room: room,
+		peer: peer,
+		box:  &OutputBox{selected: -1, highlight: chatUi.highlight},
+	}
+	// the server keeps no history of direct conversations
+	tab.box.historyComplete = peer != ""
+	tab.box.resize(chatUi.layout.outputWidth, chatUi.layout.outputHeight)
+	chatUi.tabs = append(chatUi.tabs, tab)
+	if chatUi.outputBox == nil {
+		chatUi.outputBox = tab.box
+	}
+	return tab
+}
+
+// Shows the tab at the given position of the tab bar, marking its messages as read. The expanded thread and
+// any pending reply, edit or reaction belong to the previous tab and are dropped.
+func (chatUi *ChatClientUI) switchTab(index int) {
+	if index < 0 || index >= len(chatUi.tabs) {
+		return
+	}
+	if index != chatUi.activeTab {
+		chatUi.cancelPending()
+		chatUi.thread = nil
+	}
+	chatUi.activeTab = index
+	tab := chatUi.tab()
+	tab.unread = 0
+	tab.mentions = 0
+	chatUi.outputBox = tab.box
+	chatUi.relayout()
+	// a room shown for the first time starts with its latest history
+	if len(tab.box.messages) == 0 {
+		chatUi.loadOlderHistory()
+	}
+}
+
+// Closes the tab at the given position, leaving its room. The last tab can't be closed.
+func (chatUi *ChatClientUI) closeTab(index int) {
+	if len(chatUi.tabs) == 1 {
+		chatUi.notice = "The last tab can't be closed"
+		return
+	}
+	tab := chatUi.tabs[index]
+	if tab.room != "" {
+		chatUi.sendPresence(Presence_PART, tab.room)
+	}
+	chatUi.tabs = append(chatUi.tabs[:index], chatUi.tabs[index+1:]...)
+	switch {
+	case index < chatUi.activeTab:
+		chatUi.activeTab--
+	case index == chatUi.activeTab:
+		// show the tab before the closed one, without keeping anything that belonged to the closed one
+		chatUi.activeTab = -1
+		chatUi.switchTab(maxInt(index-1, 0))
+	}
+}
+
+// Returns the tab a message belongs to: the tab of its room or of the direct conversation with its sender.
+// A tab is opened for a direct conversation when open is true, messages for rooms that weren't joined are
+// dropped.
+func (chatUi *ChatClientUI) tabOf(message *ChatMessage, open bool) *chatTab {
+	if message.Recipient == "" {
+		room := message.Room
+		if room == "" {
+			room = default_room
+		}
+		return chatUi.findTab(room, "")
+	}
+	peer := message.UserName
+	if message.UserId == chatUi.userId {
+		peer = message.Recipient
+	}
+	if open {
+		return chatUi.openTab("", peer)
+	}
+	return chatUi.findTab("", peer)
+}
+
+// Tells the server that the local user joined or left the room
+func (chatUi *ChatClientUI) sendPresence(state Presence_State, room string) {
+	chatUi.messageChannel <- &Presence{
+		UserId:   chatUi.userId,
+		UserName: chatUi.userName,
+		State:    state,
+		Room:     room,
+	}
+}
+
+// Keeps track of the users online and in the rooms joined, as announced by the server
+func (chatUi *ChatClientUI) receivePresence(presence *Presence) {
+	switch presence.State {
+	case Presence_ONLINE:
+		chatUi.online = presence.Users
+	case Presence_OFFLINE:
+		chatUi.online = presence.Users
+		// a user going offline leaves every room
+		for _, tab := range chatUi.tabs {
+			tab.members = removeString(tab.members, presence.UserName)
+		}
+	case Presence_JOIN, Presence_PART:
+		if tab := chatUi.findTab(presence.Room, ""); tab != nil {
+			tab.members = presence.Users
+		}
+	}
+}
+
+// Returns the list without the given string
+func removeString(list []string, s string) (result []string) {
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return
+}
+
+// Joins the room named by the arguments and shows its tab
+func (chatUi *ChatClientUI) joinRoom(args string) {
+	room := strings.TrimPrefix(args, "#")
+	if room == "" || strings.ContainsAny(room, " \t") {
+		chatUi.notice = "Usage: /join <room>"
+		return
+	}
+	tab := chatUi.findTab(room, "")
+	if tab == nil {
+		tab = chatUi.openTab(room, "")
+		chatUi.sendPresence(Presence_JOIN, room)
+	}
+	chatUi.switchTab(chatUi.tabIndex(tab))
+}
+
+// Leaves the room named by the arguments, or the room shown when there are none, closing its tab.
+// Leaving a direct conversation closes its tab.
+func (chatUi *ChatClientUI) partRoom(args string) {
+	if args == "" {
+		chatUi.closeTab(chatUi.activeTab)
+		return
+	}
+	index := chatUi.tabIndex(chatUi.findTab(strings.TrimPrefix(args, "#"), ""))
+	if strings.HasPrefix(args, "@") {
+		index = chatUi.tabIndex(chatUi.findTab("", args[1:]))
+	}
+	if index < 0 {
+		chatUi.notice = "No tab is open for " + args
+		return
+	}
+	chatUi.closeTab(index)
+}
+
+// Shows the direct conversation with the user named by the arguments, sending the rest of the arguments to them
+func (chatUi *ChatClientUI) messageUser(args string) {
+	peer, text := args, ""
+	if i := strings.IndexAny(args, " \t"); i >= 0 {
+		peer, text = args[:i], strings.TrimSpace(args[i+1:])
+	}
+	peer = strings.TrimPrefix(peer, "@")
+	switch {
+	case peer == "":
+		chatUi.notice = "Usage: /msg <user> [message]"
+		return
+	case peer == chatUi.userName:
+		chatUi.notice = "Messages can't be sent to yourself"
+		return
+	}
+	chatUi.switchTab(chatUi.tabIndex(chatUi.openTab("", peer)))
+	if text != "" {
+		chatUi.sendMessage(&ChatMessage{
+			// add the prefix to the message before sending
+			Message: chatUi.editBoxPrefix + text,
+		})
+	}
+}
+
+// Lists the users in the room shown
+func (chatUi *ChatClientUI) listMembers(args string) {
+	tab := chatUi.tab()
+	switch {
+	case tab.peer != "":
+		chatUi.notice = fmt.Sprintf("Direct conversation with %v", tab.peer)
+	case len(tab.members) == 0:
+		chatUi.notice = fmt.Sprintf("No one is known to be in %v", tab.name())
+	default:
+		chatUi.notice = fmt.Sprintf("In %v: %v", tab.name(), strings.Join(tab.members, ", "))
+	}
+}
+
+// Draws the tab bar across the top row of the terminal. The tab shown is reversed, other tabs count the
+// messages they received since they were last shown and the mentions and keywords among them.
+func (chatUi *ChatClientUI) drawTabBar(y int) {
+	const coldef = termbox.ColorDefault
+	screen := chatUi.screen
+	x := 0
+	for i := range chatUi.tabs {
+		label, fg := chatUi.tabLabel(i)
+		width := runewidth.StringWidth(label)
+		if x+width > chatUi.termWidth {
+			tbprint(screen, x, y, coldef, coldef, runewidth.Truncate(label, chatUi.termWidth-x, "…"))
+			return
+		}
+		tbprint(screen, x, y, fg, coldef, label)
+		x += width + 1
+	}
+}
+
+// Returns the label of the tab at the index as shown on the tab bar and its colour
+func (chatUi *ChatClientUI) tabLabel(i int) (label string, fg termbox.Attribute) {
+	tab := chatUi.tabs[i]
+	label = fmt.Sprintf(" %v %v ", i+1, tab.name())
+	fg = termbox.ColorDefault
+	switch {
+	case i == chatUi.activeTab:
+		fg |= termbox.AttrReverse
+	case tab.mentions > 0:
+		label = fmt.Sprintf(" %v %v (%v, %v@) ", i+1, tab.name(), tab.unread, tab.mentions)
+		fg = termbox.ColorYellow | termbox.AttrBold
+	case tab.unread > 0:
+		label = fmt.Sprintf(" %v %v (%v) ", i+1, tab.name(), tab.unread)
+		fg |= termbox.AttrBold
+	}
+	return
+}
+
+// Returns the index of the tab whose label is at the column of the tab bar, -1 when there is none
+func (chatUi *ChatClientUI) tabAt(x int) int {
+	left := 0
+	for i := range chatUi.tabs {
+		label, _ := chatUi.tabLabel(i)
+		right := left + runewidth.StringWidth(label)
+		if x >= left && x < right {
+			return i
+		}
+		left = right + 1
+	}
+	return -1
+}
@@ -5,36 +5,45 @@
 package nan0chat
 
 import (
+	"bytes"
+	"context"
+	"github.com/golang/protobuf/proto"
 	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
+	"unicode"
 	"unicode/utf8"
 	"time"
-	"math"
+	"strings"
+	"fmt"
+	"regexp"
 )
 
-func tbprint(x, y int, fg, bg termbox.Attribute, msg string) {
+func tbprint(screen Screen, x, y int, fg, bg termbox.Attribute, msg string) {
 	for _, c := range msg {
-		termbox.SetCell(x, y, c, fg, bg)
+		screen.SetCell(x, y, c, fg, bg)
 		x += runewidth.RuneWidth(c)
 	}
 }
 
-func tbprintbounded(x, y, maxX int, fg, bg termbox.Attribute, msg string) (lastx, lasty int) {
-	for i, c := range msg {
-		if i == maxX {
+func tbprintbounded(screen Screen, x, y, maxX int, fg, bg termbox.Attribute, msg string) (lastx, lasty int) {
+	startx := x
+	for _, c := range msg {
+		// continue on the next line when the rune doesn't fit in the remaining cells
+		w := runewidth.RuneWidth(c)
+		if x-startx+w > maxX {
 			y++
-			x = 0
+			x = startx
 		}
-		termbox.SetCell(x, y, c, fg, bg)
-		x += runewidth.RuneWidth(c)
+		screen.SetCell(x, y, c, fg, bg)
+		x += w
 	}
 	return x, y
 }
 
-func fill(x, y, w, h int, cell termbox.Cell) {
+func fill(screen Screen, x, y, w, h int, cell termbox.Cell) {
 	for ly := 0; ly < h; ly++ {
 		for lx := 0; lx < w; lx++ {
-			termbox.SetCell(x+lx, y+ly, cell.Ch, cell.Fg, cell.Bg)
+			screen.SetCell(x+lx, y+ly, cell.Ch, cell.Fg, cell.Bg)
 		}
 	}
 }
@@ -83,39 +92,196 @@ func byte_slice_insert(text []byte, offset int, what []byte) []byte {
 }
 
 const preferred_horizontal_threshold = 5
+
+// the edit box grows with the lines of the message up to this many rows, longer messages scroll inside it
+const max_edit_box_lines = 6
 const tabstop_length = 8
+const mouse_wheel_lines = 3
+
+// shortest time between two frames, changes made meanwhile are drawn together
+const frame_interval = 15 * time.Millisecond
+
+// terminal errors in a row after which the ui gives up
+const max_terminal_errors = 10
 
 type ChatClientUI struct {
-	editBox       EditBox
-	outputBox     OutputBox
+	// the screen the ui is drawn on and takes its input from
+	screen  Screen
+	editBox EditBox
+	// the output box of the tab shown
+	outputBox     *OutputBox
 	editBoxWidth  int
 	editBoxPrefix string
+	// current terminal size and the location of every element drawn on it
+	termWidth, termHeight int
+	layout                chatLayout
+	// id and name of the local user, stamped on every message sent from this ui
+	userId   int64
+	userName string
+	// the rooms and direct conversations open, and the position of the one shown
+	tabs      []*chatTab
+	activeTab int
+	// the users connected to the server as last announced by it
+	online []string
+	// the server connected to as host:port, the state of the connection and the round trip last measured
+	server     string
+	connection connectionState
+	latency    time.Duration
+	// the ping waiting for the server to answer, if any
+	ping *Ping
+	// the segments shown on the status bar
+	statusSegments []statusSegment
+	// finds mentions of the local user and the keywords in messages
+	highlight *regexp.Regexp
+	// true while mentions ring no bell and run no notification command, and when the command last ran
+	doNotDisturb bool
+	lastNotified time.Time
+	// the title last given to the terminal window
+	terminalTitle string
+	// channel passing sent messages and requests to the backend
+	messageChannel chan<- proto.Message
+	// the message the next sent message will reply to, if any
+	replyTo *chatEntry
+	// the message the edit box contents will replace, if any
+	editing *chatEntry
+	// the message the edit box contents will react to, if any
+	reacting *chatEntry
+	// true while the highlight cursor is moving over messages in the output box
+	selecting bool
+	// the box searched while the search prompt takes the keys, nil otherwise. Panes opening meanwhile don't
+	// change it.
+	searchBox *OutputBox
+	// an expanded thread shown next to or in place of the output box, if any
+	thread *OutputBox
+	// history search results, or the context of one of them, shown next to or in place of the output box
+	results *OutputBox
+	// the pane shown next to the output box that lost the keys to it by a click on the output box
+	unfocusedPane *OutputBox
+	// the results of the last history search, the request behind them and the hit behind every result entry
+	searchResults  *OutputBox
+	resultsRequest *SearchRequest
+	resultsTotal   int
+	searchHits     map[*chatEntry]*SearchHit
+	// the message whose details are shown over the output box, if any
+	details *chatEntry
+	// text most recently copied from a message
+	clipboard string
+	// a one-off note shown below the edit box until the next key press
+	notice string
+	// the action run by each key
+	keyBindings map[keyBinding]string
+	// the state of vi mode, nil when the edit box isn't edited with vi keys
+	vi *viState
+	// the action run by the key pressed last and by the key before it, empty for keys that run no action
+	lastAction, previousAction string
+	// text deleted by kill actions, the latest last, and the piece yanked last along with where it starts
+	killRing  []string
+	yankIndex int
+	yankStart int
+	// the completions offered by the last Tab, listed while it is the last key pressed
+	completion *completion
+	// the prefix key pressed, waiting for the key completing the sequence
+	keyPrefix *keyPress
+	// the text being pasted, nil when no paste is in progress
+	pasted *strings.Builder
+	// whether the paste in progress went beyond max_paste_bytes, what came after was left out
+	pasteTruncated bool
+	// whether the message holds a large paste, or one that stalled, the user hasn't confirmed sending yet
+	largePaste   bool
+	stalledPaste bool
+	// the lines sent before, and the search of them in progress, if any
+	history       *inputHistory
+	historySearch *historySearch
+	// set by the /quit command to end the ui
+	quitting bool
+	// the failed attempt to connect shown over the output box, if any, and the channel asking for another attempt
+	failure      error
+	retryChannel chan<- struct{}
 }
 
 type EditBox struct {
 	text           []byte
 	line_voffset   int
+	top_line       int // first line shown when the text has more lines than the box
+	cursor_line    int // line of the cursor, lines are separated by '\n'
+	preferred_col  int // visual column kept while moving the cursor across lines of different length, -1 for none
 	cursor_boffset int // cursor offset in bytes
 	cursor_voffset int // visual cursor offset in termbox cells
 	cursor_coffset int // cursor offset in unicode code points
+	// states of the box before the changes made to the text, the latest last, and the states undone
+	undo, redo []editSnapshot
+	// what the latest change was, and where typing left the cursor, to undo a run of typing at once
+	last_edit editKind
+	typed_at  int
 }
 
 type OutputBox struct {
-	messages          []string
+	messages          []*chatEntry
+	lines             []outputLine
 	width             int
 	height            int
 	windowTopIndex    int
 	windowBottomIndex int
+	// index of the highlighted message in messages, -1 when nothing is selected
+	selected int
+	// the root of the thread shown in this box, nil when showing every message
+	threadRoot *chatEntry
+	// text shown on the top border
+	title string
+	// number of messages added while the window was scrolled away from the latest messages
+	unread int
+	// the search highlighting matches in this box, if any
+	search *scrollbackSearch
+	// the request for older history on its way, and whether the server has no older messages left
+	historyRequest  *HistoryRequest
+	historyComplete bool
+	// finds the mentions and keywords highlighted in alerting messages
+	highlight *regexp.Regexp
+}
+
+// A message held by the output box along with the changes later messages made to it
+type chatEntry struct {
+	*ChatMessage
+	// text shown before the message, such as the date of a search result
+	label string
+	// true when the message mentions the local user or a keyword
+	alert     bool
+	edited    bool
+	deleted   bool
+	reactions []reaction
+}
+
+// A reaction and the number of times it was given to a message
+type reaction struct {
+	emoji string
+	count int
 }
 
-// Draws the EditBox in the given location, 'h' is not used at the moment
-func (eb *EditBox) Draw(x, y, w, h int) {
+// A single wrapped line of the output box and the message it was produced from
+type outputLine struct {
+	text    string
+	message *chatEntry
+	quote   bool
+}
+
+// maximum number of cells of a parent message quoted above a reply
+const quote_excerpt_length = 40
+
+// Draws the lines of the EditBox that fit in the given location, every line scrolled to the column of the cursor
+func (eb *EditBox) Draw(screen Screen, x, y, w, h int) {
 	eb.AdjustVOffset(w)
+	eb.AdjustTopLine(h)
 
-	const coldef = termbox.ColorDefault
-	fill(x, y, w, h, termbox.Cell{Ch: ' '})
+	fill(screen, x, y, w, h, termbox.Cell{Ch: ' '})
+	lines := bytes.Split(eb.text, []byte{'\n'})
+	for i := 0; i < h && eb.top_line+i < len(lines); i++ {
+		eb.drawLine(screen, x, y+i, w, lines[eb.top_line+i])
+	}
+}
 
-	t := eb.text
+// Draws a single line of text, marking the parts hidden by horizontal scrolling with arrows
+func (eb *EditBox) drawLine(screen Screen, x, y, w int, t []byte) {
+	const coldef = termbox.ColorDefault
 	lx := 0
 	tabstop := 0
 	for {
@@ -129,7 +295,7 @@ func (eb *EditBox) Draw(x, y, w, h int) {
 		}
 
 		if rx >= w {
-			termbox.SetCell(x+w-1, y, '→',
+			screen.SetCell(x+w-1, y, '→',
 				coldef, coldef)
 			break
 		}
@@ -143,12 +309,12 @@ func (eb *EditBox) Draw(x, y, w, h int) {
 				}
 
 				if rx >= 0 {
-					termbox.SetCell(x+rx, y, ' ', coldef, coldef)
+					screen.SetCell(x+rx, y, ' ', coldef, coldef)
 				}
 			}
 		} else {
 			if rx >= 0 {
-				termbox.SetCell(x+rx, y, r, coldef, coldef)
+				screen.SetCell(x+rx, y, r, coldef, coldef)
 			}
 			lx += runewidth.RuneWidth(r)
 		}
@@ -157,7 +323,20 @@ func (eb *EditBox) Draw(x, y, w, h int) {
 	}
 
 	if eb.line_voffset != 0 {
-		termbox.SetCell(x, y, '←', coldef, coldef)
+		screen.SetCell(x, y, '←', coldef, coldef)
+	}
+}
+
+// Adjusts the first line shown so the line of the cursor is inside a box of the given height
+func (eb *EditBox) AdjustTopLine(height int) {
+	if eb.cursor_line < eb.top_line {
+		eb.top_line = eb.cursor_line
+	}
+	if eb.cursor_line >= eb.top_line+height {
+		eb.top_line = eb.cursor_line - height + 1
+	}
+	if last := eb.LineCount() - height; eb.top_line > last {
+		eb.top_line = maxInt(last, 0)
 	}
 }
 
@@ -185,9 +364,78 @@ func (eb *EditBox) AdjustVOffset(width int) {
 	}
 }
 
+// Moves the cursor to the byte offset, the visual offset is counted from the start of the line of the cursor
 func (eb *EditBox) MoveCursorTo(boffset int) {
 	eb.cursor_boffset = boffset
-	eb.cursor_voffset, eb.cursor_coffset = voffset_coffset(eb.text, boffset)
+	start := eb.lineStart()
+	eb.cursor_voffset, eb.cursor_coffset = voffset_coffset(eb.text[start:], boffset-start)
+	eb.cursor_line = bytes.Count(eb.text[:boffset], []byte{'\n'})
+	eb.preferred_col = -1
+}
+
+// Returns the byte offset of the start of the line of the cursor
+func (eb *EditBox) lineStart() int {
+	return bytes.LastIndexByte(eb.text[:eb.cursor_boffset], '\n') + 1
+}
+
+// Returns the byte offset of the end of the line of the cursor, just before its line break
+func (eb *EditBox) lineEnd() int {
+	if end := bytes.IndexByte(eb.text[eb.cursor_boffset:], '\n'); end >= 0 {
+		return eb.cursor_boffset + end
+	}
+	return len(eb.text)
+}
+
+// Returns the number of lines of the text, an empty text has a single empty line
+func (eb *EditBox) LineCount() int {
+	return bytes.Count(eb.text, []byte{'\n'}) + 1
+}
+
+// Moves the cursor to the line before its own, as close to the same column as that line allows. Returns false
+// when the cursor is on the first line already.
+func (eb *EditBox) MoveCursorLineUp() bool {
+	start := eb.lineStart()
+	if start == 0 {
+		return false
+	}
+	col := eb.column()
+	eb.MoveCursorTo(start - 1)
+	eb.moveCursorToColumn(col)
+	return true
+}
+
+// Moves the cursor to the line after its own, as close to the same column as that line allows. Returns false
+// when the cursor is on the last line already.
+func (eb *EditBox) MoveCursorLineDown() bool {
+	end := eb.lineEnd()
+	if end == len(eb.text) {
+		return false
+	}
+	col := eb.column()
+	eb.MoveCursorTo(end + 1)
+	eb.moveCursorToColumn(col)
+	return true
+}
+
+// Returns the column the cursor moves to on another line, which is kept from line to line
+func (eb *EditBox) column() int {
+	if eb.preferred_col >= 0 {
+		return eb.preferred_col
+	}
+	return eb.cursor_voffset
+}
+
+// Moves the cursor along its line to the given visual column, or to the end of a shorter line
+func (eb *EditBox) moveCursorToColumn(col int) {
+	end := eb.lineEnd()
+	for eb.cursor_boffset < end {
+		r, size := eb.RuneUnderCursor()
+		if eb.cursor_voffset+rune_advance_len(r, eb.cursor_voffset) > col {
+			break
+		}
+		eb.MoveCursorTo(eb.cursor_boffset + size)
+	}
+	eb.preferred_col = col
 }
 
 func (eb *EditBox) RuneUnderCursor() (rune, int) {
@@ -215,10 +463,15 @@ func (eb *EditBox) MoveCursorOneRuneForward() {
 }
 
 func (eb *EditBox) MoveCursorToBeginningOfTheLine() {
-	eb.MoveCursorTo(0)
+	eb.MoveCursorTo(eb.lineStart())
 }
 
 func (eb *EditBox) MoveCursorToEndOfTheLine() {
+	eb.MoveCursorTo(eb.lineEnd())
+}
+
+// Moves the cursor to the end of the last line
+func (eb *EditBox) MoveCursorToEnd() {
 	eb.MoveCursorTo(len(eb.text))
 }
 
@@ -227,6 +480,7 @@ func (eb *EditBox) DeleteRuneBackward() {
 		return
 	}
 
+	eb.SaveUndo(edit_other)
 	eb.MoveCursorOneRuneBackward()
 	_, size := eb.RuneUnderCursor()
 	eb.text = byte_slice_remove(eb.text, eb.cursor_boffset, eb.cursor_boffset+size)
@@ -236,183 +490,803 @@ func (eb *EditBox) DeleteRuneForward() {
 	if eb.cursor_boffset == len(eb.text) {
 		return
 	}
+	eb.SaveUndo(edit_other)
 	_, size := eb.RuneUnderCursor()
 	eb.text = byte_slice_remove(eb.text, eb.cursor_boffset, eb.cursor_boffset+size)
 }
 
-func (eb *EditBox) DeleteTheRestOfTheLine() {
-	eb.text = eb.text[:eb.cursor_boffset]
+// Deletes from the cursor to the end of its line, at the end of a line the line break is deleted instead.
+// Returns the text deleted.
+func (eb *EditBox) DeleteTheRestOfTheLine() string {
+	end := eb.lineEnd()
+	if end == eb.cursor_boffset && end < len(eb.text) {
+		end++
+	}
+	return eb.deleteRange(eb.cursor_boffset, end)
 }
 
+// Inserts the rune at the cursor, a run of runes typed one after another is undone at once
 func (eb *EditBox) InsertRune(r rune) {
+	eb.SaveUndo(edit_typing)
+	eb.insertRune(r)
+	eb.typed_at = eb.cursor_boffset
+}
+
+func (eb *EditBox) insertRune(r rune) {
 	var buf [utf8.UTFMax]byte
 	n := utf8.EncodeRune(buf[:], r)
 	eb.text = byte_slice_insert(eb.text, eb.cursor_boffset, buf[:n])
 	eb.MoveCursorOneRuneForward()
 }
 
+// Inserts every rune of the string at the cursor. The string is inserted at once, placing the cursor rune by rune
+// would take as long as the line for every rune of a long paste.
+func (eb *EditBox) InsertString(s string) {
+	if s == "" {
+		return
+	}
+	eb.SaveUndo(edit_other)
+	what := []byte(strings.ToValidUTF8(s, string(utf8.RuneError)))
+	eb.text = byte_slice_insert(eb.text, eb.cursor_boffset, what)
+	eb.MoveCursorTo(eb.cursor_boffset + len(what))
+}
+
+// Replaces the contents of the edit box, placing the cursor at the end
+func (eb *EditBox) SetText(s string) {
+	eb.SaveUndo(edit_other)
+	eb.text = []byte(s)
+	eb.line_voffset = 0
+	eb.top_line = 0
+	eb.MoveCursorToEnd()
+}
+
 // Please, keep in mind that cursor depends on the value of line_voffset, which
 // is being set on Draw() call, so.. call this method after Draw() one.
 func (eb *EditBox) CursorX() int {
 	return eb.cursor_voffset - eb.line_voffset
 }
 
+// Returns the column inside the box of the byte offset on the line of the cursor, which like CursorX is only
+// known after Draw()
+func (eb *EditBox) ColumnOf(boffset int) int {
+	start := eb.lineStart()
+	voffset, _ := voffset_coffset(eb.text[start:], boffset-start)
+	return voffset - eb.line_voffset
+}
+
+// Returns the row of the cursor inside the box, which like CursorX is only known after Draw()
+func (eb *EditBox) CursorY() int {
+	return eb.cursor_line - eb.top_line
+}
+
+// Returns the number of rows the box takes to show its lines, up to max_edit_box_lines
+func (eb *EditBox) Height() int {
+	if lines := eb.LineCount(); lines < max_edit_box_lines {
+		return lines
+	}
+	return max_edit_box_lines
+}
+
 func (eb *EditBox) Clear() {
 	eb.cursor_boffset = 0
 	eb.cursor_coffset = 0
 	eb.cursor_voffset = 0
 	eb.line_voffset = 0
+	eb.top_line = 0
+	eb.cursor_line = 0
+	eb.preferred_col = -1
 	eb.text = nil
+	// a new message starts with nothing to undo
+	eb.undo, eb.redo = nil, nil
+	eb.last_edit = edit_other
 }
 
-func (chatUi *ChatClientUI) Start(prefix string, messageChannel chan<- string) {
-	// configure output box
-	chatUi.outputBox.width = 90
-	chatUi.outputBox.height = 20
-	chatUi.outputBox.windowTopIndex = 0
-	chatUi.outputBox.windowBottomIndex = chatUi.outputBox.height - 1
-
+// Runs the ui until the user quits or the context is done, then restores the terminal and closes messageChannel.
+// Returns a *TerminalError when the terminal can't be used.
+// The ui is owned by the goroutine running it: key presses, messages from the server (arriving on serverChannel)
+// and timers are all handled there, one at a time, and the screen is drawn again shortly after anything changed,
+// once for every burst of changes.
+func (chatUi *ChatClientUI) Start(ctx context.Context, prefix string, messageChannel chan<- proto.Message,
+	serverChannel <-chan interface{}) error {
 	// configure edit box
-	chatUi.editBoxWidth = chatUi.outputBox.width
 	chatUi.editBoxPrefix = prefix
+	chatUi.messageChannel = messageChannel
+	if chatUi.history == nil {
+		chatUi.history = &inputHistory{}
+	}
+	if chatUi.keyBindings == nil {
+		chatUi.keyBindings = defaultKeyBindings()
+	}
+	// nothing is sent once the ui is gone, the backend finishes sending what was sent before
+	defer close(messageChannel)
 
-	err := termbox.Init()
+	err := chatUi.screen.Init()
 	if err != nil {
-		panic(err)
+		return &TerminalError{err}
 	}
-	defer termbox.Close()
-	termbox.SetInputMode(termbox.InputEsc)
+	defer chatUi.screen.Close()
+	events := readEvents(chatUi.screen)
+
+	// size every element to the terminal
+	chatUi.resize(chatUi.screen.Size())
 
 	chatUi.redraw_all()
 
-	// constantly redraw output box so that we can update output box when new
-	// strings are written to the output box message list
-	go func() {
-		for {
-			time.Sleep(30 * time.Millisecond)
-			chatUi.redraw_all()
-		}
-	}()
-mainloop:
+	// measure the round trip to the server regularly
+	pingTicker := time.NewTicker(ping_interval)
+	defer pingTicker.Stop()
+	// the clock on the status bar changes every minute
+	clock := time.After(untilNextMinute())
+
+	// the next frame is drawn when this fires, nil while nothing changed since the last frame
+	var frame <-chan time.Time
+	// terminal errors in a row, the terminal is given up on when they keep coming
+	terminalErrors := 0
 	for {
-		switch ev := termbox.PollEvent(); ev.Type {
-		case termbox.EventKey:
-			switch ev.Key {
-			case termbox.KeyEsc:
-				break mainloop
-			case termbox.KeyArrowUp:
-				chatUi.outputBox.windowUp()
-			case termbox.KeyArrowDown:
-				chatUi.outputBox.windowDown()
-			case termbox.KeyCtrlC:
-				chatUi.outputBox.clearMessages()
-			case termbox.KeyArrowLeft, termbox.KeyCtrlB:
-				chatUi.editBox.MoveCursorOneRuneBackward()
-			case termbox.KeyArrowRight, termbox.KeyCtrlF:
-				chatUi.editBox.MoveCursorOneRuneForward()
-			case termbox.KeyBackspace, termbox.KeyBackspace2:
-				chatUi.editBox.DeleteRuneBackward()
-			case termbox.KeyDelete, termbox.KeyCtrlD:
-				chatUi.editBox.DeleteRuneForward()
-			case termbox.KeyTab:
-				chatUi.editBox.InsertRune('\t')
-			case termbox.KeySpace:
-				chatUi.editBox.InsertRune(' ')
-			case termbox.KeyCtrlK:
-				chatUi.editBox.DeleteTheRestOfTheLine()
-			case termbox.KeyHome, termbox.KeyCtrlA:
-				chatUi.editBox.MoveCursorToBeginningOfTheLine()
-			case termbox.KeyEnd, termbox.KeyCtrlE:
-				chatUi.editBox.MoveCursorToEndOfTheLine()
-			case termbox.KeyEnter:
-				if len(chatUi.editBox.text) > 0 {
-					// add the prefix to the message before sending
-					fullMsg := chatUi.editBoxPrefix + string(chatUi.editBox.text)
-					messageChannel <- fullMsg
-					chatUi.outputBox.addMessage(fullMsg)
-					chatUi.editBox.Clear()
-				}
-			default:
-				if ev.Ch != 0 {
-					chatUi.editBox.InsertRune(ev.Ch)
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-events:
+			if ev.Type == termbox.EventError {
+				if terminalErrors++; terminalErrors >= max_terminal_errors {
+					return &TerminalError{ev.Err}
 				}
+				chatUi.notice = fmt.Sprintf("Terminal error: %v", ev.Err)
+				break
+			}
+			terminalErrors = 0
+			if chatUi.handleEvent(ev) || chatUi.quitting {
+				return nil
+			}
+		case message := <-serverChannel:
+			chatUi.receive(message)
+		case <-pingTicker.C:
+			chatUi.sendPing()
+		case <-clock:
+			clock = time.After(untilNextMinute())
+		case <-frame:
+			frame = nil
+			chatUi.redraw_all()
+			continue
+		}
+		if frame == nil {
+			frame = time.After(frame_interval)
+		}
+	}
+}
+
+// Returns the time left until the minute changes
+func untilNextMinute() time.Duration {
+	now := time.Now()
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+// Handles a terminal event, returning true when the user quits
+func (chatUi *ChatClientUI) handleEvent(ev termbox.Event) bool {
+	switch ev.Type {
+	case eventPasteStart:
+		chatUi.pasted = &strings.Builder{}
+		chatUi.pasteTruncated = false
+	case eventPasteEnd:
+		chatUi.endPaste(false)
+	case eventPasteStalled:
+		chatUi.endPaste(true)
+	case termbox.EventKey:
+		if chatUi.pasted != nil {
+			// the keys beyond the limit are still part of the paste, they are left out until it ends
+			if chatUi.pasted.Len() < max_paste_bytes {
+				addPastedKey(chatUi.pasted, ev)
+			} else {
+				chatUi.pasteTruncated = true
 			}
-		case termbox.EventError:
-			panic(ev.Err)
+			return false
+		}
+		quit := chatUi.handleKey(ev)
+		// the edit box grows and shrinks with the lines of the message
+		if chatUi.editBox.Height() != chatUi.layout.editHeight {
+			chatUi.relayout()
+		}
+		return quit
+	case termbox.EventMouse:
+		chatUi.handleMouse(ev)
+	case termbox.EventResize:
+		chatUi.resize(ev.Width, ev.Height)
+	}
+	return false
+}
+
+// Handles a key press, returning true when the user quits
+func (chatUi *ChatClientUI) handleKey(ev termbox.Event) bool {
+	chatUi.notice = ""
+	chatUi.previousAction, chatUi.lastAction = chatUi.lastAction, ""
+	// a failed attempt to connect takes the keys until the user retries or quits
+	if chatUi.failure != nil {
+		return chatUi.handleFailureKey(ev)
+	}
+	// any key closes the message details
+	if chatUi.details != nil {
+		chatUi.details = nil
+		return false
+	}
+	// while selecting, keys move the highlight cursor instead of editing
+	if chatUi.selecting {
+		chatUi.handleSelectionKey(ev)
+		return false
+	}
+	if chatUi.searchBox != nil {
+		chatUi.handleSearchKey(ev)
+		return false
+	}
+	if chatUi.historySearch != nil && chatUi.handleHistorySearchKey(ev) {
+		return false
+	}
+	// the key after a prefix key completes the sequence whatever the mode
+	if chatUi.keyPrefix != nil {
+		chatUi.runKeyAction(ev)
+		return false
+	}
+	if chatUi.vi != nil && chatUi.handleViKey(ev) {
+		return false
+	}
+	// every other key runs the action bound to it, or types its character
+	switch {
+	case chatUi.runKeyAction(ev):
+	case ev.Key == termbox.KeySpace:
+		chatUi.editBox.InsertRune(' ')
+	case ev.Ch != 0:
+		chatUi.editBox.InsertRune(ev.Ch)
+	}
+	return false
+}
+
+// Sends the edit box contents as a new message, or as the edit or reaction that is pending
+func (chatUi *ChatClientUI) submit() {
+	if len(chatUi.editBox.text) == 0 {
+		return
+	}
+	// a large paste, or one that stalled, is sent once submitting again confirms it
+	unconfirmed := chatUi.largePaste && isLargePaste(string(chatUi.editBox.text)) || chatUi.stalledPaste
+	if unconfirmed && chatUi.previousAction != "submit" {
+		return
+	}
+	chatUi.largePaste, chatUi.stalledPaste = false, false
+	text := string(chatUi.editBox.text)
+	switch {
+	case chatUi.editing == nil && chatUi.reacting == nil && chatUi.runCommand(text):
+		// the line was a command, nothing is sent
+	case chatUi.connection != state_connected:
+		// the edit box keeps the text to be sent later
+		chatUi.notice = "Not connected to the server, nothing was sent"
+		return
+	case chatUi.editing != nil:
+		chatUi.sendMessage(&ChatMessage{
+			Action:   ChatMessage_EDIT,
+			TargetId: chatUi.editing.MessageId,
+			// add the prefix to the message before sending
+			Message: chatUi.editBoxPrefix + text,
+		})
+	case chatUi.reacting != nil:
+		chatUi.sendMessage(&ChatMessage{
+			Action:   ChatMessage_REACT,
+			TargetId: chatUi.reacting.MessageId,
+			Message:  text,
+		})
+		// reactions aren't worth recalling
+		chatUi.editBox.Clear()
+		chatUi.cancelPending()
+		return
+	default:
+		// sending a message returns to the latest messages
+		chatUi.activeOutputBox().scrollToBottom()
+		chatUi.sendMessage(&ChatMessage{
+			// add the prefix to the message before sending
+			Message: chatUi.editBoxPrefix + text,
+			ReplyTo: chatUi.replyTarget(),
+		})
+	}
+	chatUi.remember(text)
+	chatUi.editBox.Clear()
+	chatUi.cancelPending()
+}
+
+// Stamps the message as sent by the local user, passes it to the backend and shows it locally
+func (chatUi *ChatClientUI) sendMessage(message *ChatMessage) {
+	message.UserId = chatUi.userId
+	message.UserName = chatUi.userName
+	message.Room = chatUi.tab().room
+	message.Recipient = chatUi.tab().peer
+	message.MessageId = random.Int63()
+	message.Time = time.Now().Unix()
+	chatUi.messageChannel <- message
+	chatUi.receiveMessage(message)
+}
+
+// Forgets any pending reply, edit or reaction, an abandoned edit also empties the edit box
+func (chatUi *ChatClientUI) cancelPending() {
+	if chatUi.editing != nil {
+		chatUi.editBox.Clear()
+	}
+	chatUi.replyTo = nil
+	chatUi.editing = nil
+	chatUi.reacting = nil
+}
+
+// Returns true when the arrow keys scroll the text area instead of recalling sent lines: while it is scrolled
+// away from the latest messages or a pane takes the keys
+func (chatUi *ChatClientUI) scrollbackFocused() bool {
+	box := chatUi.activeOutputBox()
+	return box != chatUi.outputBox || !box.following()
+}
+
+// Returns the output box that takes the keys, which is the side pane when one is open unless the output box
+// next to it was clicked
+func (chatUi *ChatClientUI) activeOutputBox() *OutputBox {
+	if pane := chatUi.sidePane(); pane != nil && (pane != chatUi.unfocusedPane || chatUi.layout.sideWidth == 0) {
+		return pane
+	}
+	return chatUi.outputBox
+}
+
+// Returns the pane shown next to or in place of the output box: search results or an expanded thread
+func (chatUi *ChatClientUI) sidePane() *OutputBox {
+	if chatUi.results != nil {
+		return chatUi.results
+	}
+	return chatUi.thread
+}
+
+// Closes the search results, or the expanded thread when there are no results, returning to the output box.
+// The context of a search result goes back to the results.
+func (chatUi *ChatClientUI) closePane() {
+	if chatUi.results != nil && chatUi.results != chatUi.searchResults && chatUi.searchResults != nil {
+		chatUi.results = chatUi.searchResults
+	} else if chatUi.results != nil {
+		chatUi.results = nil
+	} else {
+		chatUi.thread = nil
+	}
+	chatUi.relayout()
+}
+
+// Returns the id of the message that a newly sent message answers, replies inside an expanded
+// thread answer the thread root unless another message was picked
+func (chatUi *ChatClientUI) replyTarget() int64 {
+	if chatUi.replyTo != nil {
+		return chatUi.replyTo.MessageId
+	}
+	if chatUi.thread != nil && chatUi.results == nil {
+		return chatUi.thread.threadRoot.MessageId
+	}
+	return 0
+}
+
+// Handles a message from the server, or a change of the connection to it
+func (chatUi *ChatClientUI) receive(message interface{}) {
+	removeControls(message)
+	switch message := message.(type) {
+	case connectionState:
+		chatUi.setConnection(message)
+	case error:
+		chatUi.connectionFailed(message)
+	case *ChatMessage:
+		chatUi.receiveMessage(message)
+	case *SearchResponse:
+		chatUi.showSearchResults(message)
+	case *HistoryResponse:
+		chatUi.receiveHistory(message)
+	case *Presence:
+		chatUi.receivePresence(message)
+	case *Ping:
+		chatUi.receivePing(message)
+	case *User:
+		// the server stamps the messages of the user with the id it gave the connection
+		chatUi.userId = message.UserId
+	}
+}
+
+// Removes the control characters from the names and text of what was received. They are sent by other users,
+// who could otherwise end the text drawn or the terminal title early and write escape sequences of their own.
+func removeControls(message interface{}) {
+	switch message := message.(type) {
+	case *ChatMessage:
+		removeMessageControls(message)
+	case *SearchResponse:
+		for _, hit := range message.Hits {
+			removeMessageControls(hit.Message)
+			for _, context := range append(hit.Before, hit.After...) {
+				removeMessageControls(context)
+			}
+		}
+	case *HistoryResponse:
+		message.Room = withoutControls(message.Room, false)
+		for _, chatMessage := range message.Messages {
+			removeMessageControls(chatMessage)
+		}
+	case *Presence:
+		message.UserName = withoutControls(message.UserName, false)
+		message.Room = withoutControls(message.Room, false)
+		for i := range message.Users {
+			message.Users[i] = withoutControls(message.Users[i], false)
+		}
+	}
+}
+
+func removeMessageControls(message *ChatMessage) {
+	if message == nil {
+		return
+	}
+	message.UserName = withoutControls(message.UserName, false)
+	message.Room = withoutControls(message.Room, false)
+	message.Recipient = withoutControls(message.Recipient, false)
+	message.Message = withoutControls(message.Message, true)
+}
+
+// Returns the text without control characters, keeping line breaks and tabs when it may have more than one line
+func withoutControls(text string, multiline bool) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !(multiline && (r == '\n' || r == '\t')) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// Adds a sent or received message to the output box of its tab and to the expanded thread it belongs to, edits,
+// deletions and reactions are applied to the message they target instead. Messages received for a tab that
+// isn't shown are counted on the tab bar.
+func (chatUi *ChatClientUI) receiveMessage(message *ChatMessage) {
+	tab := chatUi.tabOf(message, message.Action == ChatMessage_POST)
+	if tab == nil {
+		return
+	}
+	shown := tab == chatUi.tab()
+	if message.Action != ChatMessage_POST {
+		if tab.box.applyAction(message) {
+			tab.box.rebuildLines()
+			if chatUi.thread != nil && shown {
+				chatUi.thread.rebuildLines()
+			}
+		}
+		return
+	}
+	entry := &chatEntry{ChatMessage: message, alert: chatUi.alerts(message)}
+	tab.box.addMessage(entry)
+	if entry.alert {
+		chatUi.notify(tab, message)
+	}
+	switch {
+	case shown && chatUi.thread != nil && tab.box.threadRootOf(entry) == chatUi.thread.threadRoot:
+		chatUi.thread.addMessage(entry)
+	case !shown && message.UserId != chatUi.userId:
+		tab.unread++
+		if entry.alert {
+			tab.mentions++
 		}
 	}
 }
 
 func (chatUi *ChatClientUI) redraw_all() {
 	const coldef = termbox.ColorDefault
-	termbox.Clear(coldef, coldef)
+	screen := chatUi.screen
+	screen.Clear(coldef, coldef)
+
+	// every element is placed according to the layout computed for the terminal size
+	l := chatUi.layout
+	midx := l.editX
+	midy := l.editY
 
-	// setup initial locations for all ui elements
-	// initial output box element location (top-left)
-	outputx := 1
-	outputy := 1
-	// initial edit box element location (top-left)
-	midy := chatUi.outputBox.height + 3
-	midx := outputy
+	chatUi.drawTabBar(l.tabBarY)
 
 	// unicode box drawing chars around the edit box
-	termbox.SetCell(midx-1, midy, '│', coldef, coldef)
-	termbox.SetCell(midx+chatUi.editBoxWidth, midy, '│', coldef, coldef)
-	termbox.SetCell(midx-1, midy-1, '┌', coldef, coldef)
-	termbox.SetCell(midx-1, midy+1, '└', coldef, coldef)
-	termbox.SetCell(midx+chatUi.editBoxWidth, midy-1, '┐', coldef, coldef)
-	termbox.SetCell(midx+chatUi.editBoxWidth, midy+1, '┘', coldef, coldef)
-	fill(midx, midy-1, chatUi.editBoxWidth, 1, termbox.Cell{Ch: '─'})
-	fill(midx, midy+1, chatUi.editBoxWidth, 1, termbox.Cell{Ch: '─'})
+	fill(screen, midx-1, midy, 1, l.editHeight, termbox.Cell{Ch: '│'})
+	fill(screen, midx+chatUi.editBoxWidth, midy, 1, l.editHeight, termbox.Cell{Ch: '│'})
+	screen.SetCell(midx-1, midy-1, '┌', coldef, coldef)
+	screen.SetCell(midx-1, midy+l.editHeight, '└', coldef, coldef)
+	screen.SetCell(midx+chatUi.editBoxWidth, midy-1, '┐', coldef, coldef)
+	screen.SetCell(midx+chatUi.editBoxWidth, midy+l.editHeight, '┘', coldef, coldef)
+	fill(screen, midx, midy-1, chatUi.editBoxWidth, 1, termbox.Cell{Ch: '─'})
+	fill(screen, midx, midy+l.editHeight, chatUi.editBoxWidth, 1, termbox.Cell{Ch: '─'})
 
-	// draw unicode output box
-	fill(outputx-1, outputy, 1, chatUi.outputBox.height, termbox.Cell{Ch: '|'})
-	fill(outputx+chatUi.outputBox.width, outputy, 1, chatUi.outputBox.height, termbox.Cell{Ch: '|'})
-	termbox.SetCell(outputx-1, outputy-1, '┌', coldef, coldef)
-	termbox.SetCell(outputx-1, outputy+chatUi.outputBox.height, '└', coldef, coldef)
-	termbox.SetCell(outputx+chatUi.outputBox.width, outputy-1, '┐', coldef, coldef)
-	termbox.SetCell(outputx+chatUi.outputBox.width, outputy+chatUi.outputBox.height, '┘', coldef, coldef)
-	fill(outputx, outputy-1, chatUi.outputBox.width, 1, termbox.Cell{Ch: '─'})
-	fill(outputx, outputy+chatUi.outputBox.height, chatUi.outputBox.width, 1, termbox.Cell{Ch: '─'})
+	// draw the output box, an open pane is drawn beside it or in place of it
+	box := chatUi.activeOutputBox()
+	pane := chatUi.sidePane()
+	bottomKeys := chatUi.keysOf("bottom")
+	switch {
+	case pane != nil && l.sideWidth > 0:
+		chatUi.outputBox.draw(screen, l.outputX, l.outputY, bottomKeys)
+		pane.draw(screen, l.sideX, l.outputY, bottomKeys)
+	case pane != nil:
+		pane.draw(screen, l.outputX, l.outputY, bottomKeys)
+	default:
+		chatUi.outputBox.draw(screen, l.outputX, l.outputY, bottomKeys)
+	}
 
 	// finishing touches on edit box
-	chatUi.editBox.Draw(midx, midy, chatUi.editBoxWidth, 1)
-	termbox.SetCursor(midx+chatUi.editBox.CursorX(), midy)
+	chatUi.editBox.Draw(screen, midx, midy, chatUi.editBoxWidth, l.editHeight)
+	screen.SetCursor(midx+chatUi.editBox.CursorX(), midy+chatUi.editBox.CursorY())
+	if chatUi.completion != nil && chatUi.lastAction == "complete" {
+		chatUi.drawCompletion(midx+chatUi.editBox.ColumnOf(chatUi.completion.start), midy-3)
+	}
+
+	// show what the user is doing with the selected message, if anything
+	switch {
+	case chatUi.searchBox != nil:
+		prompt, cursor := chatUi.searchPrompt()
+		tbprint(screen, midx+6, l.hintY, coldef, coldef, prompt)
+		screen.SetCursor(midx+6+cursor, l.hintY)
+	case chatUi.historySearch != nil:
+		prompt, cursor := chatUi.historySearchPrompt()
+		tbprint(screen, midx+6, l.hintY, coldef, coldef, prompt)
+		screen.SetCursor(midx+6+cursor, l.hintY)
+	default:
+		tbprint(screen, midx+6, l.hintY, coldef, coldef, chatUi.hint())
+	}
+
+	chatUi.drawStatusBar(l.statusY)
+	chatUi.updateTerminalTitle()
+
+	if chatUi.failure != nil {
+		chatUi.drawFailure(l.outputX+4, l.outputY+2, chatUi.outputBox.width-8)
+	} else if chatUi.details != nil {
+		x := l.outputX
+		if box == pane && l.sideWidth > 0 {
+			x = l.sideX
+		}
+		chatUi.drawDetails(x+4, l.outputY+2, box.width-8)
+	}
+
+	screen.Flush()
+}
+
+// Draws the output box with its border and title at the given location (top-left, inside the border). The keys
+// jumping to the latest message are named while it is scrolled back.
+func (outputBox *OutputBox) draw(screen Screen, outputx, outputy int, bottomKeys string) {
+	const coldef = termbox.ColorDefault
 
-	// write instructions
-	tbprint(midx+6, midy+3, coldef, coldef, "Press ESC to quit")
+	// draw unicode output box
+	fill(screen, outputx-1, outputy, 1, outputBox.height, termbox.Cell{Ch: '|'})
+	fill(screen, outputx+outputBox.width, outputy, 1, outputBox.height, termbox.Cell{Ch: '|'})
+	screen.SetCell(outputx-1, outputy-1, '┌', coldef, coldef)
+	screen.SetCell(outputx-1, outputy+outputBox.height, '└', coldef, coldef)
+	screen.SetCell(outputx+outputBox.width, outputy-1, '┐', coldef, coldef)
+	screen.SetCell(outputx+outputBox.width, outputy+outputBox.height, '┘', coldef, coldef)
+	fill(screen, outputx, outputy-1, outputBox.width, 1, termbox.Cell{Ch: '─'})
+	fill(screen, outputx, outputy+outputBox.height, outputBox.width, 1, termbox.Cell{Ch: '─'})
+	if outputBox.title != "" {
+		tbprint(screen, outputx+2, outputy-1, coldef, coldef, outputBox.title)
+	} else if indicator := outputBox.historyIndicator(); indicator != "" {
+		tbprint(screen, outputx+2, outputy-1, coldef|termbox.AttrBold, coldef, indicator)
+	}
+	if indicator := outputBox.scrollIndicator(bottomKeys); indicator != "" {
+		x := outputx + outputBox.width - runewidth.StringWidth(indicator) - 2
+		tbprint(screen, x, outputy+outputBox.height, coldef|termbox.AttrBold, coldef, indicator)
+	}
 
 	// write all messages to the ouptut box
 	lasty := outputy
-	for i, msg := range chatUi.outputBox.messages {
-		if i >= chatUi.outputBox.windowTopIndex && i < chatUi.outputBox.windowBottomIndex {
-			_, lasty = tbprintbounded(outputx+1, lasty+1, chatUi.outputBox.width-1, coldef, coldef, msg)
+	for i, line := range outputBox.lines {
+		if i >= outputBox.windowTopIndex && i < outputBox.windowBottomIndex {
+			fg, bg := outputBox.lineColors(line)
+			if matches := outputBox.searchMatches(line); len(matches) > 0 {
+				// matches are highlighted, the current one stands out in bold
+				attr := termbox.Attribute(0)
+				if outputBox.isCurrentHit(line) {
+					attr = termbox.AttrBold
+				}
+				lasty++
+				tbprinthighlighted(screen, outputx+1, lasty, fg, bg, line.text, matches, termbox.AttrReverse|attr)
+				continue
+			}
+			// mentions and keywords stand out in the messages that alert the user
+			if line.message != nil && line.message.alert && !line.quote {
+				if matches := alertMatches(outputBox.highlight, line.text); len(matches) > 0 {
+					lasty++
+					tbprinthighlighted(screen, outputx+1, lasty, fg, bg, line.text, matches, termbox.ColorYellow|termbox.AttrBold)
+					continue
+				}
+			}
+			_, lasty = tbprintbounded(screen, outputx+1, lasty+1, outputBox.width-1, fg, bg, line.text)
 		}
 	}
+}
+
+// Adds a new message to the output box, shifting the draw window if there are too many messages to be safely added.
+// A window scrolled up into the history stays put and counts the message as unread instead.
+func (outputBox *OutputBox) addMessage(entry *chatEntry) {
+	following := outputBox.following()
+	outputBox.messages = append(outputBox.messages, entry)
+	outputBox.appendEntryLines(entry)
+	if !following {
+		outputBox.unread++
+		return
+	}
+	// adjust window height til message fits
+	for len(outputBox.lines)-1 >= outputBox.windowBottomIndex {
+		outputBox.windowDown()
+	}
+}
+
+// Appends the lines that display the message, preceded by a short quote of the message it replies to
+// and followed by its reactions
+func (outputBox *OutputBox) appendEntryLines(entry *chatEntry) {
+	if entry.ReplyTo != 0 {
+		outputBox.appendLines(outputBox.quoteOf(entry.ReplyTo), entry, true)
+	}
+	outputBox.appendLines(entry.label+entry.displayText(), entry, false)
+	if len(entry.reactions) > 0 {
+		outputBox.appendLines(entry.reactionText(), entry, false)
+	}
+}
 
-	termbox.Flush()
+// Regenerates every line of the output box after messages it holds have changed
+func (outputBox *OutputBox) rebuildLines() {
+	outputBox.lines = nil
+	for _, entry := range outputBox.messages {
+		outputBox.appendEntryLines(entry)
+	}
+	// keep the window inside the regenerated lines
+	for outputBox.windowBottomIndex > len(outputBox.lines) && outputBox.windowTopIndex > 0 {
+		outputBox.windowUp()
+	}
 }
 
-// Adds a new message to the output box, shifting the draw window if there are too many messages to be safely added
-func (outputBox *OutputBox) addMessage(message string) {
-	messageLength := float64(len(message))
-	modifiedWidth := float64(outputBox.width - 1)
-	// if the message length is longer than the width of the outputbox, we must wrap by breaking up the message in
-	// sizes equal to the width
-	if messageLength > modifiedWidth {
-		for i := 0.0; i < math.Ceil(messageLength/modifiedWidth); i++ {
-			lowIdex := int(i * modifiedWidth)
-			// the min in this expression is to bound the idex to the actual message size
-			highIdex := int(math.Min((i*modifiedWidth)+modifiedWidth, messageLength))
-			outputBox.messages = append(outputBox.messages, message[lowIdex:highIdex])
+// Applies an edit, deletion or reaction to the message it targets, returning false if the target isn't held
+// or the action isn't allowed on it
+func (outputBox *OutputBox) applyAction(message *ChatMessage) bool {
+	target := outputBox.findMessage(message.TargetId)
+	if target == nil || target.deleted {
+		return false
+	}
+	switch message.Action {
+	case ChatMessage_EDIT:
+		// only the sender of a message may change it
+		if target.UserId != message.UserId {
+			return false
 		}
-	} else {
-		outputBox.messages = append(outputBox.messages, message)
+		target.Message = message.Message
+		target.edited = true
+	case ChatMessage_DELETE:
+		if target.UserId != message.UserId {
+			return false
+		}
+		target.deleted = true
+		target.reactions = nil
+	case ChatMessage_REACT:
+		target.addReaction(message.Message)
+	default:
+		return false
 	}
-	// adjust window height til message fits
-	for len(outputBox.messages)-1 >= outputBox.windowBottomIndex {
+	return true
+}
+
+// Returns the text shown for the message, taking edits and deletion into account
+func (entry *chatEntry) displayText() string {
+	if entry.deleted {
+		return "(message deleted)"
+	}
+	if entry.edited {
+		return entry.Message + " (edited)"
+	}
+	return entry.Message
+}
+
+// Counts another reaction on the message
+func (entry *chatEntry) addReaction(emoji string) {
+	for i := range entry.reactions {
+		if entry.reactions[i].emoji == emoji {
+			entry.reactions[i].count++
+			return
+		}
+	}
+	entry.reactions = append(entry.reactions, reaction{emoji, 1})
+}
+
+// Returns the reactions of the message as a single line
+func (entry *chatEntry) reactionText() string {
+	parts := make([]string, len(entry.reactions))
+	for i, r := range entry.reactions {
+		parts[i] = fmt.Sprintf("[%v %v]", r.emoji, r.count)
+	}
+	return "  " + strings.Join(parts, " ")
+}
+
+// Appends the text to the output box as lines produced from the given message, wrapped to the width of the box
+func (outputBox *OutputBox) appendLines(text string, message *chatEntry, quote bool) {
+	for _, line := range wrapText(text, outputBox.width-1) {
+		outputBox.lines = append(outputBox.lines, outputLine{line, message, quote})
+	}
+}
+
+// Returns the quote line shown above a reply to the message with the given id
+func (outputBox *OutputBox) quoteOf(messageId int64) string {
+	if parent := outputBox.findMessage(messageId); parent != nil {
+		return "↳ " + excerpt(parent.displayText())
+	}
+	return "↳ (earlier message)"
+}
+
+// Shortens a message to a single line excerpt suitable for quoting
+func excerpt(message string) string {
+	message = strings.Replace(message, "\n", " ", -1)
+	return runewidth.Truncate(message, quote_excerpt_length, "…")
+}
+
+// Returns the message with the given id held in the output box, or nil if it is not held
+func (outputBox *OutputBox) findMessage(messageId int64) *chatEntry {
+	for i := len(outputBox.messages) - 1; i >= 0; i-- {
+		if outputBox.messages[i].MessageId == messageId {
+			return outputBox.messages[i]
+		}
+	}
+	return nil
+}
+
+// Follows the replies up from the given message to the first message of its thread still held in the output box
+func (outputBox *OutputBox) threadRootOf(message *chatEntry) *chatEntry {
+	for message.ReplyTo != 0 {
+		parent := outputBox.findMessage(message.ReplyTo)
+		if parent == nil {
+			break
+		}
+		message = parent
+	}
+	return message
+}
+
+// Returns the highlighted message, or nil when nothing is selected
+func (outputBox *OutputBox) selectedMessage() *chatEntry {
+	if outputBox.selected < 0 || outputBox.selected >= len(outputBox.messages) {
+		return nil
+	}
+	return outputBox.messages[outputBox.selected]
+}
+
+// Moves the highlight cursor to the previous message
+func (outputBox *OutputBox) selectPrevious() {
+	if outputBox.selected > 0 {
+		outputBox.selected--
+		outputBox.scrollToMessage(outputBox.selected)
+	}
+}
+
+// Moves the highlight cursor to the next message
+func (outputBox *OutputBox) selectNext() {
+	if outputBox.selected < len(outputBox.messages)-1 {
+		outputBox.selected++
+		outputBox.scrollToMessage(outputBox.selected)
+	}
+}
+
+// Shifts the drawing window until every line of the message at the given index is visible
+func (outputBox *OutputBox) scrollToMessage(index int) {
+	message := outputBox.messages[index]
+	first, last := -1, -1
+	for i, line := range outputBox.lines {
+		if line.message == message {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	for last >= outputBox.windowBottomIndex && outputBox.windowBottomIndex < len(outputBox.lines) {
 		outputBox.windowDown()
 	}
+	for first >= 0 && first < outputBox.windowTopIndex {
+		outputBox.windowUp()
+	}
+}
+
+// Returns the colors a line is drawn with, quotes are dimmed and the selected message is highlighted
+func (outputBox *OutputBox) lineColors(line outputLine) (fg, bg termbox.Attribute) {
+	fg, bg = termbox.ColorDefault, termbox.ColorDefault
+	if line.quote {
+		fg = termbox.ColorCyan
+	}
+	if selected := outputBox.selectedMessage(); selected != nil && line.message == selected {
+		fg |= termbox.AttrReverse
+	}
+	return
 }
 
 // Shifts the drawing window for messages up, so that earlier messages can be viewed
@@ -425,15 +1299,81 @@ func (outputBox *OutputBox) windowUp() {
 
 // Shifts the drawing window for messages down, so that the latest messages can be viewed
 func (outputBox *OutputBox) windowDown() {
-	if outputBox.windowBottomIndex < len(outputBox.messages) {
+	if outputBox.windowBottomIndex < len(outputBox.lines) {
 		outputBox.windowTopIndex++
 		outputBox.windowBottomIndex++
 	}
+	if outputBox.following() {
+		outputBox.unread = 0
+	}
+}
+
+// Returns true when the drawing window shows the latest line, so that new messages scroll into view
+func (outputBox *OutputBox) following() bool {
+	return outputBox.windowBottomIndex >= len(outputBox.lines)
+}
+
+// Shifts the drawing window up by the given number of lines
+func (outputBox *OutputBox) scrollUp(lines int) {
+	for i := 0; i < lines; i++ {
+		outputBox.windowUp()
+	}
+}
+
+// Shifts the drawing window down by the given number of lines
+func (outputBox *OutputBox) scrollDown(lines int) {
+	for i := 0; i < lines; i++ {
+		outputBox.windowDown()
+	}
+}
+
+// Shifts the drawing window down by a page, keeping one line of the previous page in view
+func (outputBox *OutputBox) pageDown() {
+	outputBox.scrollDown(outputBox.pageSize())
+}
+
+// Returns the number of lines a page scrolls by
+func (outputBox *OutputBox) pageSize() int {
+	return maxInt(outputBox.windowBottomIndex-outputBox.windowTopIndex-1, 1)
+}
+
+// Shifts the drawing window to the first line held
+func (outputBox *OutputBox) scrollToTop() {
+	outputBox.scrollUp(outputBox.windowTopIndex)
+}
+
+// Shifts the drawing window to the latest line held, marking every message as read
+func (outputBox *OutputBox) scrollToBottom() {
+	outputBox.scrollDown(len(outputBox.lines) - outputBox.windowBottomIndex)
+	outputBox.unread = 0
+}
+
+// Returns the text shown on the bottom border of the output box while it is scrolled up into the history, naming
+// the keys that jump to the latest message
+func (outputBox *OutputBox) scrollIndicator(bottomKeys string) string {
+	keys := ""
+	if bottomKeys != "" {
+		keys = " (" + bottomKeys + ")"
+	}
+	switch {
+	case outputBox.unread == 1:
+		return " 1 new message ↓" + keys + " "
+	case outputBox.unread > 1:
+		return fmt.Sprintf(" %v new messages ↓%v ", outputBox.unread, keys)
+	case !outputBox.following() && bottomKeys != "":
+		return " ↓ " + bottomKeys + " to jump to the latest "
+	case !outputBox.following():
+		return " ↓ scrolled back "
+	}
+	return ""
 }
 
 // Clears all messages from the output box and resets the window
 func (outputBox *OutputBox) clearMessages() {
-	outputBox.messages = make([]string, outputBox.height)
+	outputBox.messages = nil
+	outputBox.unread = 0
+	outputBox.lines = make([]outputLine, outputBox.height)
 	outputBox.windowBottomIndex = outputBox.height
 	outputBox.windowTopIndex = 0
+	outputBox.selected = -1
 }
@@ -0,0 +1,324 @@
+package nan0chat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nsf/termbox-go"
+)
+
+// Returns a ui connected to nothing, drawn on a memory screen of the given size and showing the default room
+func newTestUI(width, height int) (*ChatClientUI, *MemoryScreen) {
+	screen := NewMemoryScreen(width, height)
+	chatUi := &ChatClientUI{
+		screen:         screen,
+		history:        &inputHistory{},
+		keyBindings:    defaultKeyBindings(),
+		messageChannel: make(chan proto.Message, 100),
+		connection:     state_connected,
+	}
+	chatUi.openTab(default_room, "")
+	chatUi.resize(width, height)
+	return chatUi, screen
+}
+
+// Passes a key press to the ui like the event loop does
+func pressKey(chatUi *ChatClientUI, ev termbox.Event) {
+	ev.Type = termbox.EventKey
+	chatUi.handleEvent(ev)
+}
+
+// Returns the row of the screen holding the text, -1 when no row does
+func rowOf(screen *MemoryScreen, text string) int {
+	for y, row := range strings.Split(screen.String(), "\n") {
+		if strings.Contains(row, text) {
+			return y
+		}
+	}
+	return -1
+}
+
+func TestRedrawShowsMessagesAndTyping(t *testing.T) {
+	chatUi, screen := newTestUI(60, 20)
+	chatUi.outputBox.addMessage(&chatEntry{ChatMessage: &ChatMessage{Message: "@someone: good morning"}})
+	for _, r := range "hi" {
+		pressKey(chatUi, termbox.Event{Ch: r})
+	}
+	chatUi.redraw_all()
+
+	if y := rowOf(screen, "@someone: good morning"); y < chatUi.layout.outputY || y >= chatUi.layout.editY {
+		t.Errorf("message drawn on row %v, want inside the output box\n%v", y, screen)
+	}
+	l := chatUi.layout
+	if cell := screen.Cell(l.editX, l.editY); cell.Ch != 'h' {
+		t.Errorf("edit box starts with %q, want 'h'\n%v", cell.Ch, screen)
+	}
+	if x, y := screen.Cursor(); x != l.editX+2 || y != l.editY {
+		t.Errorf("cursor at %v,%v, want after the text typed at %v,%v", x, y, l.editX+2, l.editY)
+	}
+}
+
+// A history search result opening the results pane while the scrollback is searched used to crash the redraw
+func TestFindResultsArrivingDuringScrollbackSearch(t *testing.T) {
+	chatUi, screen := newTestUI(60, 20)
+	chatUi.outputBox.addMessage(&chatEntry{ChatMessage: &ChatMessage{Message: "hello"}})
+	chatUi.findInHistory("hello")
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyCtrlS})
+	chatUi.receive(&SearchResponse{
+		RequestId: chatUi.resultsRequest.RequestId,
+		Total:     1,
+		Hits:      []*SearchHit{{Message: &ChatMessage{Message: "hello from the history"}}},
+	})
+	chatUi.redraw_all()
+	pressKey(chatUi, termbox.Event{Ch: 'h'})
+	chatUi.redraw_all()
+
+	if rowOf(screen, "hello from the history") < 0 {
+		t.Errorf("the results pane isn't shown\n%v", screen)
+	}
+	if y := rowOf(screen, "Search text: h"); y != chatUi.layout.hintY {
+		t.Errorf("search prompt drawn on row %v, want the hint row %v\n%v", y, chatUi.layout.hintY, screen)
+	}
+	if chatUi.outputBox.search == nil || chatUi.outputBox.search.query != "h" {
+		t.Errorf("the query typed didn't go to the output box searched")
+	}
+}
+
+// A paste whose end never arrives mustn't take every key typed after it, nor be sent by an Enter among them
+func TestStalledPasteIsSentOnlyOnceConfirmed(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.handleEvent(termbox.Event{Type: eventPasteStart})
+	for _, r := range "one" {
+		chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: r})
+	}
+	chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+	chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 't'})
+	chatUi.handleEvent(termbox.Event{Type: eventPasteStalled})
+	if text := string(chatUi.editBox.text); text != "one\nt" {
+		t.Fatalf("edit box holds %q after the paste, want \"one\\nt\"", text)
+	}
+	pressKey(chatUi, termbox.Event{Ch: 'o'})
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyEnter})
+	if len(chatUi.messageChannel) != 0 || string(chatUi.editBox.text) != "one\nto" {
+		t.Fatalf("the first Enter after the paste sent %q", chatUi.editBox.text)
+	}
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyEnter})
+	if len(chatUi.messageChannel) != 1 {
+		t.Errorf("pressing Enter again didn't send the message")
+	}
+}
+
+// The text pasted beyond max_paste_bytes is left out, Enter in it doesn't send anything
+func TestPasteBeyondTheLimitIsLeftOut(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.handleEvent(termbox.Event{Type: eventPasteStart})
+	for i := 0; i < max_paste_bytes; i++ {
+		chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'a'})
+	}
+	chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+	chatUi.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'b'})
+	chatUi.handleEvent(termbox.Event{Type: eventPasteEnd})
+	if len(chatUi.messageChannel) != 0 {
+		t.Errorf("a message was sent during the paste")
+	}
+	if text := string(chatUi.editBox.text); len(text) != max_paste_bytes || strings.Trim(text, "a") != "" {
+		t.Errorf("edit box holds %v bytes ending in %q, want the first %v bytes pasted", len(text),
+			text[len(text)-1:], max_paste_bytes)
+	}
+}
+
+// Copying an edited message takes the text sent, not the marker shown after it
+func TestCopyEditedMessageLeavesOutTheMarker(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	osc52, file := *Osc52, *ClipboardFile
+	defer func() { *Osc52, *ClipboardFile = osc52, file }()
+	*Osc52, *ClipboardFile = false, filepath.Join(t.TempDir(), "clipboard.txt")
+
+	chatUi.copyEntry(&chatEntry{ChatMessage: &ChatMessage{Message: "@someone: good evening"}, edited: true})
+	if data, err := ioutil.ReadFile(*ClipboardFile); err != nil || string(data) != "@someone: good evening" {
+		t.Errorf("copied %q (%v), want the message text", data, err)
+	}
+	if chatUi.clipboard != "@someone: good evening" {
+		t.Errorf("kept %q for Ctrl-V, want the message text", chatUi.clipboard)
+	}
+}
+
+// The escape sequences for the terminal go to the screen, not to the standard output
+func TestTitleBellAndClipboardAreWrittenToTheScreen(t *testing.T) {
+	chatUi, screen := newTestUI(60, 20)
+	t.Setenv("TERM", "xterm")
+	t.Setenv("TMUX", "")
+	osc52 := *Osc52
+	defer func() { *Osc52 = osc52 }()
+	*Osc52 = true
+
+	chatUi.updateTerminalTitle()
+	chatUi.notify(chatUi.tab(), &ChatMessage{UserName: "someone", Message: "@someone: hi"})
+	chatUi.copyText("hi", "message")
+	if raw, want := screen.Raw(), "\x1b]0;nan0chat #general\a"+"\a"+"\x1b]52;c;aGk=\a"; raw != want {
+		t.Errorf("wrote %q to the terminal, want %q", raw, want)
+	}
+}
+
+// A direct message from a user whose name holds control characters mustn't write escape sequences to the terminal
+func TestControlCharactersInNamesDontReachTheTerminal(t *testing.T) {
+	chatUi, screen := newTestUI(60, 20)
+	chatUi.userId = 1
+	name := "eve\a\x1b]52;c;aGk=\a"
+	chatUi.receive(&ChatMessage{UserId: 2, UserName: name, Recipient: "me", Message: "@" + name + ": hi\x1b[2J\nthere"})
+	tab := chatUi.findTab("", "eve]52;c;aGk=")
+	if tab == nil {
+		t.Fatalf("no tab opened for the sender without control characters in the name")
+	}
+	chatUi.switchTab(chatUi.tabIndex(tab))
+	chatUi.updateTerminalTitle()
+
+	// the bell for the direct message, then the title
+	if raw, want := screen.Raw(), "\a\x1b]0;nan0chat @eve]52;c;aGk=\a"; raw != want {
+		t.Errorf("wrote %q to the terminal, want %q", raw, want)
+	}
+	if message := tab.box.messages[0].Message; message != "@eve]52;c;aGk=: hi[2J\nthere" {
+		t.Errorf("received %q, want the text without control characters and with its line break", message)
+	}
+}
+
+// A clipboard file created by someone else before is made private before the text copied is written to it
+func TestClipboardFileIsPrivate(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	osc52, file := *Osc52, *ClipboardFile
+	defer func() { *Osc52, *ClipboardFile = osc52, file }()
+	*Osc52, *ClipboardFile = false, filepath.Join(t.TempDir(), "clipboard.txt")
+	if err := ioutil.WriteFile(*ClipboardFile, []byte("something longer copied before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chatUi.copyText("secret", "message")
+	info, err := os.Stat(*ClipboardFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("clipboard file mode %v, want -rw-------", info.Mode().Perm())
+	}
+	if data, _ := ioutil.ReadFile(*ClipboardFile); string(data) != "secret" {
+		t.Errorf("clipboard file holds %q, want \"secret\"", data)
+	}
+}
+
+// The keys switching tabs are bindings like any other, they can be changed and unbound
+func TestTabKeysCanBeRebound(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.openTab("random", "")
+	chatUi.openTab("", "someone")
+	pressKey(chatUi, termbox.Event{Ch: '3', Mod: termbox.ModAlt})
+	if chatUi.activeTab != 2 {
+		t.Fatalf("Alt-3 showed tab %v, want 2", chatUi.activeTab)
+	}
+	pressKey(chatUi, termbox.Event{Ch: 'n', Mod: termbox.ModAlt})
+	if chatUi.activeTab != 0 {
+		t.Fatalf("Alt-n showed tab %v, want the first again", chatUi.activeTab)
+	}
+
+	if err := parseKeyBindings("Alt-2 none\nF2 tab-2\nAlt-n none", chatUi.keyBindings); err != nil {
+		t.Fatal(err)
+	}
+	pressKey(chatUi, termbox.Event{Ch: '2', Mod: termbox.ModAlt})
+	pressKey(chatUi, termbox.Event{Ch: 'n', Mod: termbox.ModAlt})
+	if chatUi.activeTab != 0 {
+		t.Errorf("unbound keys showed tab %v", chatUi.activeTab)
+	}
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyF2})
+	if chatUi.activeTab != 1 {
+		t.Errorf("F2 showed tab %v, want 1", chatUi.activeTab)
+	}
+}
+
+func TestScrollIndicatorNamesTheKeysBound(t *testing.T) {
+	chatUi, screen := newTestUI(60, 20)
+	for i := 0; i < 40; i++ {
+		chatUi.outputBox.addMessage(&chatEntry{ChatMessage: &ChatMessage{Message: "line"}})
+	}
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyPgup})
+	if err := parseKeyBindings("End none\nCtrl-E bottom", chatUi.keyBindings); err != nil {
+		t.Fatal(err)
+	}
+	chatUi.redraw_all()
+	if rowOf(screen, "Ctrl-E to jump to the latest") < 0 {
+		t.Errorf("the scroll indicator doesn't name the key bound\n%v", screen)
+	}
+}
+
+// Selection actions on a search result work on the message held by the tab of its room
+func TestSelectionActionsOnSearchResultsUseTheTabOfTheMessage(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	outgoing := make(chan proto.Message, 100)
+	chatUi.messageChannel = outgoing
+	chatUi.userId = 1
+	random := chatUi.openTab("random", "")
+	random.box.addMessage(&chatEntry{ChatMessage: &ChatMessage{MessageId: 5, UserId: 1, Room: "random", Message: "hello"}})
+	chatUi.findInHistory("hello")
+	chatUi.receive(&SearchResponse{
+		RequestId: chatUi.resultsRequest.RequestId,
+		Total:     2,
+		Hits: []*SearchHit{
+			{Message: &ChatMessage{MessageId: 4, UserId: 1, Room: "random", Message: "hello before"}},
+			{Message: &ChatMessage{MessageId: 5, UserId: 1, Room: "random", Message: "hello"}},
+		},
+	})
+
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyCtrlO})
+	pressKey(chatUi, termbox.Event{Ch: 'd'})
+	if chatUi.tab() != random || chatUi.results != nil {
+		t.Fatalf("deleting a result didn't show the tab of its room")
+	}
+	var sent *ChatMessage
+	for sent == nil {
+		sent, _ = (<-outgoing).(*ChatMessage)
+	}
+	if sent.Action != ChatMessage_DELETE || sent.TargetId != 5 || sent.Room != "random" {
+		t.Errorf("sent %v, want the deletion of message 5 in random", sent)
+	}
+	if !random.box.messages[0].deleted {
+		t.Errorf("the message held by the tab wasn't deleted")
+	}
+
+	// a message the tab doesn't hold can't be replied to from the results
+	chatUi.switchTab(0)
+	chatUi.results = chatUi.searchResults
+	chatUi.relayout()
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyCtrlO})
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyArrowUp})
+	pressKey(chatUi, termbox.Event{Ch: 'r'})
+	if chatUi.replyTo != nil || chatUi.tab() == random {
+		t.Errorf("replying to a message the tab doesn't hold went ahead")
+	}
+}
+
+// Older history arriving during a search mustn't move the place a cancelled search goes back to
+func TestCancelledSearchGoesBackAfterOlderHistoryArrives(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	box := chatUi.outputBox
+	for i := 0; i < 40; i++ {
+		box.addMessage(&chatEntry{ChatMessage: &ChatMessage{MessageId: int64(100 + i), Message: fmt.Sprint("message ", i)}})
+	}
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyPgup})
+	top := box.lines[box.windowTopIndex].text
+
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyCtrlS})
+	for _, r := range "message 1" {
+		pressKey(chatUi, termbox.Event{Ch: r})
+	}
+	box.historyRequest = &HistoryRequest{RequestId: 7, Room: default_room}
+	chatUi.receive(&HistoryResponse{RequestId: 7, Room: default_room, HasMore: true, Messages: []*ChatMessage{
+		{MessageId: 1, Message: "older 1"}, {MessageId: 2, Message: "older 2"},
+	}})
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyEsc})
+	if text := box.lines[box.windowTopIndex].text; text != top {
+		t.Errorf("the window starts at %q after cancelling the search, want %q", text, top)
+	}
+}
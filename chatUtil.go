@@ -2,9 +2,10 @@ package nan0chat
 
 import (
 	"encoding/base64"
-	"fmt"
 	"flag"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -18,6 +19,25 @@ var IsServer = flag.Bool("server", false, "Is this a server?")
 var Host = flag.String("host", "localhost", "Host name for server")
 var Port = flag.Int("port", 6865, "Port number for server (if --server is [true])")
 var CustomUsername = flag.String("username", "", "A custom user name")
+var Osc52 = flag.Bool("osc52", true, "Copy to the system clipboard with the OSC 52 terminal escape sequence")
+var ClipboardFile = flag.String("clipboard-file", "",
+	"File copied text is written to when the terminal doesn't support OSC 52 (default the clipboard file of the config directory)")
+var StatusBar = flag.String("status", "mode,state,server,room,users,latency,clock,dnd",
+	"Comma separated segments shown on the status bar: mode, state, server, room, users, latency, clock, dnd and keys")
+var Keywords = flag.String("keywords", "", "Comma separated keywords highlighted and notified like mentions")
+var NotifyCommand = flag.String("notify", "",
+	"Command run when a message mentions you, with the sender and the message as its last two arguments")
+var ViMode = flag.Bool("vi", false, "Edit messages with vi keys, starting in insert mode")
+var KeysFile = flag.String("keys", "", "File changing the key bindings (default the keys file of the config directory)")
+
+// Returns the directory the client keeps its files in, inside the user's config directory
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "nan0chat"), nil
+}
 
 // The nan0 functions require a specific key type and width, this is a way to make
 // that conversion from strings to the required type.
@@ -33,18 +53,6 @@ func KeysToNan0Bytes(encKeyShare, authKeyShare string) (encKey, authKey *[32]byt
 	return
 }
 
-// Handles errors generated in the application
-func handleErr(e error, exec func(err error) interface{}) interface{} {
-	if e != nil {
-		fmt.Printf("Error occurred: %v\n", e)
-		if exec != nil {
-			return exec(e)
-		}
-	}
-
-	return e
-}
-
 func (user *User) SetUserName(name string) {
 	user.UserName = name
 }
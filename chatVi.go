@@ -0,0 +1,507 @@
+package nan0chat
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// State of the vi mode of the edit box
+type viState struct {
+	// true in normal mode, false in insert mode
+	normal bool
+	// the count typed so far, 0 for none
+	count int
+	// the operator waiting for its motion, 0 for none, and the count typed before it
+	operator      rune
+	operatorCount int
+	// f, t, F or T waiting for the character to find, 0 for none
+	find rune
+	// the text yanked or deleted last, put back with p and P, linewise when whole lines were taken
+	register         string
+	registerLinewise bool
+}
+
+// A vi motion from the rune at pos, repeated count times. Returns where it ends, whether an operator takes the
+// rune it ends on too, and false when the motion is impossible.
+type viMotion func(text []rune, pos, count int) (target int, inclusive, ok bool)
+
+// Returns the position of the cursor in runes
+func (eb *EditBox) runePos() int {
+	return utf8.RuneCount(eb.text[:eb.cursor_boffset])
+}
+
+// Replaces the contents of the edit box with the runes, moving the cursor to the rune at pos
+func (eb *EditBox) setRunes(text []rune, pos int) {
+	eb.text = []byte(string(text))
+	eb.MoveCursorTo(len(string(text[:pos])))
+}
+
+// Returns the mode shown on the status bar when vi mode is on, nothing otherwise
+func (chatUi *ChatClientUI) viModeStatus() string {
+	switch {
+	case chatUi.vi == nil:
+		return ""
+	case chatUi.vi.normal:
+		return "-- NORMAL --"
+	}
+	return "-- INSERT --"
+}
+
+// Handles a key press in vi mode, returning false for keys that run the action bound to them as usual. Insert
+// mode leaves every key but escape to the usual actions.
+func (chatUi *ChatClientUI) handleViKey(ev termbox.Event) bool {
+	vi := chatUi.vi
+	if !vi.normal {
+		if ev.Key == termbox.KeyEsc {
+			chatUi.enterNormalMode()
+			return true
+		}
+		return false
+	}
+	if ev.Mod&termbox.ModAlt != 0 {
+		return false
+	}
+	ch := ev.Ch
+	if ev.Key == termbox.KeySpace {
+		ch = ' '
+	}
+	if vi.find != 0 {
+		find := vi.find
+		vi.find = 0
+		if ch == 0 {
+			vi.reset()
+			return true
+		}
+		chatUi.viMove(findMotion(find, ch))
+		return true
+	}
+	switch {
+	case ev.Key == termbox.KeyEsc && vi.pending():
+		vi.reset()
+		return true
+	case ev.Key == termbox.KeyEsc:
+		// escape is pressed out of habit in normal mode, so it only closes the open pane and never leaves the chat
+		return chatUi.sidePane() == nil
+	case ev.Key == termbox.KeyEnter:
+		// the message is sent and the next one is written in insert mode
+		vi.reset()
+		vi.normal = false
+		return false
+	case ev.Key == termbox.KeyCtrlR:
+		vi.reset()
+		chatUi.editBox.Redo()
+		chatUi.viClamp()
+		return true
+	case ch == 0:
+		vi.reset()
+		return false
+	}
+
+	if ch >= '1' && ch <= '9' || ch == '0' && vi.count > 0 {
+		vi.count = vi.count*10 + int(ch-'0')
+		return true
+	}
+	eb := &chatUi.editBox
+	switch ch {
+	case 'h':
+		chatUi.viMove(leftMotion)
+	case 'l', ' ':
+		chatUi.viMove(rightMotion)
+	case 'w':
+		// cw changes to the end of the word, and an operator doesn't reach past the end of the line
+		text, pos := []rune(string(eb.text)), eb.runePos()
+		switch {
+		case vi.operator == 'c' && pos < len(text) && runeClass(text[pos]) != 0:
+			chatUi.viMove(wordEndMotion)
+		case vi.operator != 0:
+			chatUi.viMove(func(text []rune, pos, count int) (int, bool, bool) {
+				target, _, _ := wordMotion(text, pos, count)
+				return minInt(target, lineEndOf(text, pos)), false, true
+			})
+		default:
+			chatUi.viMove(wordMotion)
+		}
+	case 'b':
+		chatUi.viMove(wordBackMotion)
+	case 'e':
+		chatUi.viMove(wordEndMotion)
+	case '0':
+		chatUi.viMove(func(text []rune, pos, count int) (int, bool, bool) {
+			return lineStartOf(text, pos), false, true
+		})
+	case '^':
+		chatUi.viMove(func(text []rune, pos, count int) (int, bool, bool) {
+			return firstNonBlankOf(text, pos), false, true
+		})
+	case '$':
+		chatUi.viMove(func(text []rune, pos, count int) (int, bool, bool) {
+			return lineEndOf(text, pos), false, true
+		})
+	case 'f', 't', 'F', 'T':
+		vi.find = ch
+	case 'd', 'c', 'y':
+		switch vi.operator {
+		case 0:
+			vi.operator, vi.operatorCount, vi.count = ch, vi.count, 0
+		case ch:
+			chatUi.viOperateLines()
+		default:
+			vi.reset()
+		}
+	case 'x', 'X', 's', 'D', 'C':
+		// shorthands for an operator and a motion
+		operator := map[rune]rune{'x': 'd', 'X': 'd', 's': 'c', 'D': 'd', 'C': 'c'}[ch]
+		vi.operator, vi.operatorCount = operator, 0
+		switch ch {
+		case 'X':
+			chatUi.viMove(leftMotion)
+		case 'D', 'C':
+			chatUi.viMove(func(text []rune, pos, count int) (int, bool, bool) {
+				return lineEndOf(text, pos), false, true
+			})
+		default:
+			chatUi.viMove(rightMotion)
+		}
+	case 'i', 'a', 'I', 'A', 'o', 'O':
+		chatUi.viInsert(ch)
+	case 'p', 'P':
+		chatUi.viPut(ch == 'p')
+	case 'u':
+		vi.reset()
+		eb.Undo()
+		chatUi.viClamp()
+	case 'j':
+		vi.reset()
+		chatUi.down()
+		chatUi.viClamp()
+	case 'k':
+		vi.reset()
+		chatUi.up()
+		chatUi.viClamp()
+	default:
+		vi.reset()
+	}
+	return true
+}
+
+// Returns true while a count, an operator or a character to find is typed
+func (vi *viState) pending() bool {
+	return vi.count != 0 || vi.operator != 0 || vi.find != 0
+}
+
+// Forgets the count, operator and character to find being typed
+func (vi *viState) reset() {
+	vi.count, vi.operator, vi.operatorCount, vi.find = 0, 0, 0, 0
+}
+
+// Returns the number of times the motion typed repeats, counting both the count of the operator and its own
+func (vi *viState) motionCount() int {
+	return maxInt(vi.count, 1) * maxInt(vi.operatorCount, 1)
+}
+
+// Leaves insert mode, moving the cursor back onto the last character inserted like vi does
+func (chatUi *ChatClientUI) enterNormalMode() {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	// what was typed is undone at once, apart from what is typed after the next command
+	eb.EndUndoGroup()
+	vi.normal = true
+	vi.reset()
+	if eb.cursor_boffset > eb.lineStart() {
+		eb.MoveCursorOneRuneBackward()
+	}
+}
+
+// Enters insert mode at the place the command picks: before or after the cursor, at either end of the line,
+// or on a new line below or above
+func (chatUi *ChatClientUI) viInsert(command rune) {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	vi.reset()
+	text, pos := []rune(string(eb.text)), eb.runePos()
+	switch command {
+	case 'a':
+		if pos < lineEndOf(text, pos) {
+			eb.MoveCursorOneRuneForward()
+		}
+	case 'I':
+		eb.setRunes(text, firstNonBlankOf(text, pos))
+	case 'A':
+		eb.MoveCursorToEndOfTheLine()
+	case 'o':
+		eb.MoveCursorToEndOfTheLine()
+		eb.InsertRune('\n')
+	case 'O':
+		eb.MoveCursorToBeginningOfTheLine()
+		eb.InsertRune('\n')
+		eb.MoveCursorOneRuneBackward()
+	}
+	vi.normal = false
+}
+
+// Runs the operator typed on the text between the cursor and the end of the motion
+func (chatUi *ChatClientUI) viMove(motion viMotion) {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	count, operator := vi.motionCount(), vi.operator
+	vi.reset()
+	text, pos := []rune(string(eb.text)), eb.runePos()
+	target, inclusive, ok := motion(text, pos, count)
+	if !ok {
+		return
+	}
+	if operator == 0 {
+		eb.setRunes(text, target)
+		chatUi.viClamp()
+		return
+	}
+	from, to := pos, target
+	if from > to {
+		from, to = to, from
+	}
+	if inclusive && to < len(text) {
+		to++
+	}
+	chatUi.viOperate(operator, text, from, to, false)
+}
+
+// Runs the operator typed twice, as in dd, cc and yy, on the line of the cursor and the lines after it
+func (chatUi *ChatClientUI) viOperateLines() {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	count, operator := vi.motionCount(), vi.operator
+	vi.reset()
+	text, pos := []rune(string(eb.text)), eb.runePos()
+	start, end := lineStartOf(text, pos), pos
+	for i := 0; i < count; i++ {
+		end = lineEndOf(text, end)
+		if i < count-1 && end < len(text) {
+			end++
+		}
+	}
+	switch {
+	case operator != 'd':
+		// cc keeps an empty line to insert on, yy takes the lines without changing them
+		chatUi.viOperate(operator, text, start, end, true)
+	case end < len(text):
+		chatUi.viOperate(operator, text, start, end+1, true)
+	case start > 0:
+		chatUi.viOperate(operator, text, start-1, end, true)
+	default:
+		chatUi.viOperate(operator, text, start, end, true)
+	}
+}
+
+// Yanks, deletes or changes the runes between from and to, keeping them in the register
+func (chatUi *ChatClientUI) viOperate(operator rune, text []rune, from, to int, linewise bool) {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	vi.register, vi.registerLinewise = string(text[from:to]), linewise
+	if linewise {
+		vi.register = strings.Trim(vi.register, "\n")
+	}
+	if operator == 'y' {
+		eb.setRunes(text, from)
+		chatUi.viClamp()
+		return
+	}
+	eb.SaveUndo(edit_other)
+	rest := append(append([]rune{}, text[:from]...), text[to:]...)
+	eb.setRunes(rest, minInt(from, len(rest)))
+	if operator == 'c' {
+		// the text typed instead is undone along with the change
+		eb.last_edit, eb.typed_at = edit_typing, eb.cursor_boffset
+		vi.normal = false
+		return
+	}
+	if linewise {
+		eb.setRunes(rest, firstNonBlankOf(rest, minInt(from, len(rest))))
+	}
+	chatUi.viClamp()
+}
+
+// Puts the register back after the cursor, or before it, as many times as the count says. Lines are put on
+// lines of their own below or above the line of the cursor.
+func (chatUi *ChatClientUI) viPut(after bool) {
+	vi := chatUi.vi
+	eb := &chatUi.editBox
+	count := maxInt(vi.count, 1)
+	vi.reset()
+	if vi.register == "" {
+		return
+	}
+	eb.SaveUndo(edit_other)
+	text, pos := []rune(string(eb.text)), eb.runePos()
+	put := []rune(strings.Repeat(vi.register, count))
+	var at int
+	switch {
+	case vi.registerLinewise && after:
+		at = lineEndOf(text, pos)
+		put = append([]rune{'\n'}, []rune(strings.TrimSuffix(strings.Repeat(vi.register+"\n", count), "\n"))...)
+	case vi.registerLinewise:
+		at = lineStartOf(text, pos)
+		put = []rune(strings.Repeat(vi.register+"\n", count))
+	case after && pos < lineEndOf(text, pos):
+		at = pos + 1
+	default:
+		at = pos
+	}
+	result := append(append(append([]rune{}, text[:at]...), put...), text[at:]...)
+	switch {
+	case vi.registerLinewise && after:
+		eb.setRunes(result, at+1)
+	case vi.registerLinewise:
+		eb.setRunes(result, at)
+	default:
+		eb.setRunes(result, at+len(put)-1)
+	}
+	chatUi.viClamp()
+}
+
+// Keeps the cursor on a character in normal mode, it only rests after the last character of an empty line
+func (chatUi *ChatClientUI) viClamp() {
+	eb := &chatUi.editBox
+	if chatUi.vi.normal && eb.cursor_boffset == eb.lineEnd() && eb.cursor_boffset > eb.lineStart() {
+		eb.MoveCursorOneRuneBackward()
+	}
+}
+
+// Returns the position of the first rune of the line holding pos
+func lineStartOf(text []rune, pos int) int {
+	for pos > 0 && text[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// Returns the position just after the last rune of the line holding pos
+func lineEndOf(text []rune, pos int) int {
+	for pos < len(text) && text[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// Returns the position of the first rune of the line holding pos that isn't a space or a tab
+func firstNonBlankOf(text []rune, pos int) int {
+	pos, end := lineStartOf(text, pos), lineEndOf(text, pos)
+	for pos < end && (text[pos] == ' ' || text[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+// Returns the class of a rune for word motions: 0 for spaces, 1 for word runes and 2 for punctuation
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case isWordRune(r):
+		return 1
+	}
+	return 2
+}
+
+func leftMotion(text []rune, pos, count int) (int, bool, bool) {
+	return maxInt(pos-count, lineStartOf(text, pos)), false, true
+}
+
+func rightMotion(text []rune, pos, count int) (int, bool, bool) {
+	return minInt(pos+count, lineEndOf(text, pos)), false, true
+}
+
+// Moves to the start of the next word, w
+func wordMotion(text []rune, pos, count int) (int, bool, bool) {
+	for i := 0; i < count && pos < len(text); i++ {
+		if class := runeClass(text[pos]); class != 0 {
+			for pos < len(text) && runeClass(text[pos]) == class {
+				pos++
+			}
+		}
+		for pos < len(text) && runeClass(text[pos]) == 0 {
+			pos++
+		}
+	}
+	return pos, false, true
+}
+
+// Moves to the start of the word before, b
+func wordBackMotion(text []rune, pos, count int) (int, bool, bool) {
+	for i := 0; i < count && pos > 0; i++ {
+		pos--
+		for pos > 0 && runeClass(text[pos]) == 0 {
+			pos--
+		}
+		class := runeClass(text[pos])
+		for pos > 0 && runeClass(text[pos-1]) == class {
+			pos--
+		}
+	}
+	return pos, false, true
+}
+
+// Moves to the end of the word, or of the next word when already there, e
+func wordEndMotion(text []rune, pos, count int) (int, bool, bool) {
+	if len(text) == 0 {
+		return 0, true, true
+	}
+	for i := 0; i < count && pos < len(text)-1; i++ {
+		pos++
+		for pos < len(text)-1 && runeClass(text[pos]) == 0 {
+			pos++
+		}
+		class := runeClass(text[pos])
+		for pos < len(text)-1 && runeClass(text[pos+1]) == class {
+			pos++
+		}
+	}
+	return pos, true, true
+}
+
+// Returns the motion finding the character on the line of the cursor: f moves onto the next one, t just before
+// it, and F and T do the same backwards
+func findMotion(find, ch rune) viMotion {
+	return func(text []rune, pos, count int) (int, bool, bool) {
+		start, end := lineStartOf(text, pos), lineEndOf(text, pos)
+		target := pos
+		for i := 0; i < count; i++ {
+			next := target
+			switch find {
+			case 'f', 't':
+				next++
+				// t finds past the character it stopped just before when repeated
+				if find == 't' && i > 0 {
+					next++
+				}
+				for next < end && text[next] != ch {
+					next++
+				}
+				if next >= end {
+					return pos, false, false
+				}
+			default:
+				next--
+				if find == 'T' && i > 0 {
+					next--
+				}
+				for next >= start && text[next] != ch {
+					next--
+				}
+				if next < start {
+					return pos, false, false
+				}
+			}
+			target = next
+			switch find {
+			case 't':
+				target--
+			case 'T':
+				target++
+			}
+		}
+		return target, find == 'f' || find == 't', true
+	}
+}
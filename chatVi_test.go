@@ -0,0 +1,103 @@
+package nan0chat
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestViMotions(t *testing.T) {
+	tests := []struct {
+		name      string
+		motion    viMotion
+		text      string
+		pos       int
+		count     int
+		target    int
+		inclusive bool
+		ok        bool
+	}{
+		{"h stops at the line start", leftMotion, "ab\ncd", 4, 3, 3, false, true},
+		{"l stops at the line end", rightMotion, "ab\ncd", 0, 5, 2, false, true},
+		{"w", wordMotion, "one two three", 0, 1, 4, false, true},
+		{"w counted", wordMotion, "one two three", 0, 2, 8, false, true},
+		{"w stops at punctuation", wordMotion, "one.two", 0, 1, 3, false, true},
+		{"w at the end", wordMotion, "one", 1, 1, 3, false, true},
+		{"b", wordBackMotion, "one two three", 8, 1, 4, false, true},
+		{"b from inside a word", wordBackMotion, "one two", 6, 1, 4, false, true},
+		{"b counted", wordBackMotion, "one two three", 8, 2, 0, false, true},
+		{"e", wordEndMotion, "one two", 0, 1, 2, true, true},
+		{"e at a word end", wordEndMotion, "one two", 2, 1, 6, true, true},
+		{"e of an empty text", wordEndMotion, "", 0, 1, 0, true, true},
+		{"f", findMotion('f', 'o'), "foo bar boo", 0, 1, 1, true, true},
+		{"f counted", findMotion('f', 'o'), "foo bar boo", 0, 3, 9, true, true},
+		{"f missing", findMotion('f', 'z'), "foo bar", 0, 1, 0, false, false},
+		{"f stays on the line", findMotion('f', 'b'), "foo\nbar", 0, 1, 0, false, false},
+		{"t", findMotion('t', 'b'), "foo bar", 0, 1, 3, true, true},
+		{"F", findMotion('F', 'o'), "foo bar", 6, 1, 2, false, true},
+		{"T", findMotion('T', 'f'), "foo bar", 6, 1, 1, false, true},
+	}
+	for _, test := range tests {
+		target, inclusive, ok := test.motion([]rune(test.text), test.pos, test.count)
+		if target != test.target || inclusive != test.inclusive || ok != test.ok {
+			t.Errorf("%v: got %v %v %v, want %v %v %v", test.name, target, inclusive, ok, test.target,
+				test.inclusive, test.ok)
+		}
+	}
+}
+
+// Types the keys in vi normal mode on the text, the cursor starting at its beginning, and returns the text after
+func viKeys(t *testing.T, text string, keys string) string {
+	t.Helper()
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.vi = &viState{}
+	chatUi.editBox.SetText(text)
+	chatUi.editBox.MoveCursorTo(0)
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyEsc})
+	for _, r := range keys {
+		pressKey(chatUi, termbox.Event{Ch: r})
+	}
+	return string(chatUi.editBox.text)
+}
+
+func TestViOperators(t *testing.T) {
+	tests := []struct{ text, keys, want string }{
+		{"one two three", "dw", "two three"},
+		{"one two three", "d2w", "three"},
+		{"one two three", "2dw", "three"},
+		{"one two three", "cwsix", "six two three"},
+		{"one two three", "3x", " two three"},
+		{"one two three", "wD", "one "},
+		{"one two", "de", " two"},
+		{"one two", "dfe", " two"},
+		{"one two", "dtw", "wo"},
+		{"a\nb\nc", "jdd", "a\nc"},
+		{"a\nb\nc", "yyjp", "a\nb\na\nc"},
+		{"one two", "dwu", "one two"},
+		{"one", "xxu", "ne"},
+	}
+	for _, test := range tests {
+		if got := viKeys(t, test.text, test.keys); got != test.want {
+			t.Errorf("%q on %q gave %q, want %q", test.keys, test.text, got, test.want)
+		}
+	}
+}
+
+// Escape is pressed out of habit in normal mode, it mustn't leave the chat
+func TestViEscapeInNormalModeDoesntQuit(t *testing.T) {
+	chatUi, _ := newTestUI(60, 20)
+	chatUi.vi = &viState{}
+	for i := 0; i < 3; i++ {
+		if pressKey(chatUi, termbox.Event{Key: termbox.KeyEsc}); chatUi.quitting {
+			t.Fatalf("escape pressed %v times quit", i+1)
+		}
+	}
+	if !chatUi.vi.normal {
+		t.Errorf("escape didn't switch to normal mode")
+	}
+	chatUi.listKeys("")
+	pressKey(chatUi, termbox.Event{Key: termbox.KeyEsc})
+	if chatUi.sidePane() != nil || chatUi.quitting {
+		t.Errorf("escape in normal mode didn't close the pane, or quit")
+	}
+}
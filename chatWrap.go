@@ -0,0 +1,98 @@
+package nan0chat
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Wraps text into lines no wider than the given number of terminal cells. Lines are broken after spaces
+// where possible and words wider than a line are broken between runes, so multi-byte runes are never split
+// and wide (East Asian, emoji) runes are measured by the cells they occupy. Line breaks in the text are kept
+// and tabs are expanded to spaces.
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		lines = append(lines, wrapParagraph(expandTabs(paragraph), width)...)
+	}
+	return lines
+}
+
+// Wraps a single line of text without line breaks or tabs. The spaces where a line is broken are dropped, so no
+// line but the first starts with spaces and runs of spaces never make empty lines. Spaces starting the first line
+// are kept as long as the word after them fits.
+func wrapParagraph(paragraph string, width int) (lines []string) {
+	line := ""
+	lineWidth := 0
+	// the spaces since the last word, written before the next word if it fits on the line
+	spaces := ""
+	for len(paragraph) > 0 {
+		if paragraph[0] == ' ' {
+			word := strings.TrimLeft(paragraph, " ")
+			spaces, paragraph = paragraph[:len(paragraph)-len(word)], word
+			continue
+		}
+		word := paragraph
+		if end := strings.IndexByte(paragraph, ' '); end >= 0 {
+			word = paragraph[:end]
+		}
+		paragraph = paragraph[len(word):]
+		wordWidth := runewidth.StringWidth(word)
+		switch {
+		case lineWidth+len(spaces)+wordWidth <= width:
+			line += spaces + word
+			lineWidth += len(spaces) + wordWidth
+		case lineWidth > 0:
+			lines = append(lines, line)
+			line, lineWidth = word, wordWidth
+		default:
+			// spaces starting the paragraph that leave no room for the word are dropped as well
+			line, lineWidth = word, wordWidth
+		}
+		spaces = ""
+		// a word wider than the line is broken where it reaches the edge
+		for lineWidth > width {
+			head := runewidth.Truncate(line, width, "")
+			if head == "" {
+				// a wide rune on a line narrower than it gets a line of its own
+				_, size := utf8.DecodeRuneInString(line)
+				head = line[:size]
+			}
+			if head == line {
+				break
+			}
+			lines = append(lines, head)
+			line = line[len(head):]
+			lineWidth = runewidth.StringWidth(line)
+		}
+	}
+	// spaces ending the paragraph are kept while they fit
+	if lineWidth+len(spaces) <= width {
+		line += spaces
+	}
+	return append(lines, line)
+}
+
+// Replaces tabs with spaces up to the next tab stop
+func expandTabs(text string) string {
+	if !strings.ContainsRune(text, '\t') {
+		return text
+	}
+	expanded := ""
+	width := 0
+	for _, r := range text {
+		if r == '\t' {
+			n := rune_advance_len(r, width)
+			expanded += strings.Repeat(" ", n)
+			width += n
+			continue
+		}
+		expanded += string(r)
+		width += runewidth.RuneWidth(r)
+	}
+	return expanded
+}
@@ -0,0 +1,56 @@
+package nan0chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"hello", 10, []string{"hello"}},
+		{"hello world", 11, []string{"hello world"}},
+		{"hello world", 8, []string{"hello", "world"}},
+		{"hello world", 5, []string{"hello", "world"}},
+		{"one two three four", 9, []string{"one two", "three", "four"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"ab abcdefghij", 4, []string{"ab", "abcd", "efgh", "ij"}},
+		{"a\tb\tc", 4, []string{"a", "b", "c"}},
+		{"a\tb", 10, []string{"a       b"}},
+		{"   leading", 4, []string{"lead", "ing"}},
+		{"   leading", 20, []string{"   leading"}},
+		{"a     b", 3, []string{"a", "b"}},
+		{"trailing   ", 20, []string{"trailing   "}},
+		{"trailing   ", 8, []string{"trailing"}},
+		{"one\ntwo three", 5, []string{"one", "two", "three"}},
+		{"one\n\ntwo", 5, []string{"one", "", "two"}},
+		{"héllo wörld", 5, []string{"héllo", "wörld"}},
+		{"日本語のテキスト", 6, []string{"日本語", "のテキ", "スト"}},
+		{"日本", 1, []string{"日", "本"}},
+		{"ab", 0, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		if got := wrapText(test.text, test.width); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrapText(%q, %v) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"no tabs", "no tabs"},
+		{"\tx", "        x"},
+		{"abc\tx", "abc     x"},
+		{"abcdefgh\tx", "abcdefgh        x"},
+		{"日本\tx", "日本    x"},
+	}
+	for _, test := range tests {
+		if got := expandTabs(test.text); got != test.want {
+			t.Errorf("expandTabs(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/Yomiji/nan0chat"
 	"flag"
+	"os"
 )
 
 func main() {
@@ -20,10 +21,15 @@ func main() {
 func startServer() {
 	err := nan0chat.Serve(*nan0chat.Port)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
 func startClient() {
-	nan0chat.NewChatClient().Connect()
+	err := nan0chat.NewChatClient().Connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }